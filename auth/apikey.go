@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/pkg/errors"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot
+const apiKeyPrefix = "todo_"
+
+// ErrInvalidKey is returned for an unknown, malformed or revoked API key
+var ErrInvalidKey = errors.New("invalid API key")
+
+// APIKey describes an API key. Only the SHA-256 hash of its secret is stored
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// UserID is the user acting through the key, the key is a user of its own when empty
+	UserID string `json:"userId,omitempty"`
+	// Tenant is the tenant the key is bound to, if any
+	Tenant    string     `json:"tenant,omitempty"`
+	Hash      string     `json:"hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// KeyStore holds the API keys of a local JSON file.
+// The file is read again when it changes, so keys created or revoked
+// by the admin commands take effect without restarting the server
+type KeyStore struct {
+	path string
+
+	mu      sync.Mutex
+	keys    map[string]APIKey
+	modTime time.Time
+}
+
+// apiKeyFile is the on disk representation of a KeyStore
+type apiKeyFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// LoadKeyStore reads the API key file path, a missing file holds no key
+func LoadKeyStore(path string) (*KeyStore, error) {
+	s := &KeyStore{
+		path: path,
+		keys: make(map[string]APIKey),
+	}
+	err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create generates a new API key with scopes, acting as the user userID when set,
+// and returns it along with its description.
+// The key is only returned here, it cannot be recovered from the store
+func (s *KeyStore) Create(name, userID string, scopes []string) (string, APIKey, error) {
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", APIKey{}, errors.Errorf("unknown scope %q", scope)
+		}
+	}
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := APIKey{
+		ID:        id,
+		Name:      name,
+		UserID:    userID,
+		Hash:      hashSecret(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.keys[id] = k
+	return apiKeyPrefix + id + "_" + secret, k, nil
+}
+
+// Revoke revokes the API key id
+func (s *KeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return errors.Errorf("API key %s not found", id)
+	}
+	if k.RevokedAt == nil {
+		now := time.Now().UTC()
+		k.RevokedAt = &now
+		s.keys[id] = k
+	}
+	return nil
+}
+
+// SetTenant binds the key id to tenant, or to no tenant when it is empty
+func (s *KeyStore) SetTenant(id, tenantID string) error {
+	if tenantID != "" && !tenant.Valid(tenantID) {
+		return errors.Errorf("invalid tenant %q", tenantID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return errors.Errorf("API key %s not found", id)
+	}
+	k.Tenant = tenantID
+	s.keys[id] = k
+	return nil
+}
+
+// List returns every API key, revoked ones included, oldest first
+func (s *KeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Save writes the store back to its file, readable by the owner only
+func (s *KeyStore) Save() error {
+	bts, err := json.MarshalIndent(apiKeyFile{Keys: s.List()}, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, bts, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, s.path))
+}
+
+// IsAPIKey reports whether s has the form of an API key, rather than of a token
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, apiKeyPrefix)
+}
+
+// Authenticate returns the principal of key, or ErrInvalidKey
+func (s *KeyStore) Authenticate(key string) (Principal, error) {
+	if !IsAPIKey(key) {
+		return Principal{}, ErrInvalidKey
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 {
+		return Principal{}, ErrInvalidKey
+	}
+
+	err := s.reload()
+	if err != nil {
+		return Principal{}, err
+	}
+
+	s.mu.Lock()
+	k, ok := s.keys[parts[0]]
+	s.mu.Unlock()
+	if !ok || k.RevokedAt != nil {
+		return Principal{}, ErrInvalidKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(parts[1])), []byte(k.Hash)) != 1 {
+		return Principal{}, ErrInvalidKey
+	}
+	userID := k.UserID
+	if userID == "" {
+		userID = "apikey:" + k.ID
+	}
+	return Principal{
+		User:   k.Name,
+		UserID: userID,
+		Method: MethodAPIKey,
+		Scopes: k.Scopes,
+		Tenant: k.Tenant,
+	}, nil
+}
+
+// reload reads the key file again when it changed since it was last read
+func (s *KeyStore) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !info.ModTime().After(s.modTime) {
+		return nil
+	}
+	bts, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var f apiKeyFile
+	err = json.Unmarshal(bts, &f)
+	if err != nil {
+		return errors.Wrapf(err, "invalid API key file %s", s.path)
+	}
+	keys := make(map[string]APIKey, len(f.Keys))
+	for _, k := range f.Keys {
+		keys[k.ID] = k
+	}
+	s.keys = keys
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// hashSecret returns the hex SHA-256 of secret.
+// Secrets are random, so a fast hash is enough to protect them at rest
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded by encode
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return encode(b), nil
+}
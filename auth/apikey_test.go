@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "apikeys.json")
+
+	admin, err := LoadKeyStore(path)
+	assert.Nil(t, err)
+	key, k, err := admin.Create("ci", "", []string{ScopeTodoRead})
+	assert.Nil(t, err)
+	assert.Nil(t, admin.Save())
+
+	// the server reads the keys saved by the admin commands
+	server, err := LoadKeyStore(path)
+	assert.Nil(t, err)
+	p, err := server.Authenticate(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", p.User)
+	assert.True(t, p.HasScope(ScopeTodoRead))
+	assert.False(t, p.HasScope(ScopeTodoWrite))
+
+	_, err = server.Authenticate(key + "x")
+	assert.Equal(t, ErrInvalidKey, err)
+
+	// a revoked key is rejected once the file is saved
+	assert.Nil(t, admin.Revoke(k.ID))
+	assert.Nil(t, admin.Save())
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	_, err = server.Authenticate(key)
+	assert.Equal(t, ErrInvalidKey, err)
+}
+
+func TestKeyStore_Create_UnknownScope(t *testing.T) {
+	keys, _ := LoadKeyStore(filepath.Join(os.TempDir(), "missing-apikeys.json"))
+	_, _, err := keys.Create("ci", "", []string{"todo:everything"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+)
+
+// Authentication methods
+const (
+	// MethodClientCertificate authenticates with a TLS client certificate
+	MethodClientCertificate = "client-certificate"
+	// MethodAPIKey authenticates with an API key
+	MethodAPIKey = "api-key"
+	// MethodToken authenticates with a JWT access token issued on login
+	MethodToken = "token"
+)
+
+// Scopes granted to a caller
+const (
+	// ScopeTodoRead allows reading todos
+	ScopeTodoRead = "todo:read"
+	// ScopeTodoWrite allows creating, updating and deleting todos
+	ScopeTodoWrite = "todo:write"
+	// ScopeAdmin allows everything, including backups
+	ScopeAdmin = "admin"
+)
+
+// ValidScope reports whether scope is one of the known scopes
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeTodoRead, ScopeTodoWrite, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// User names the caller
+	User string
+	// UserID identifies the caller, it owns the todos the caller creates
+	UserID string
+	// Method tells how the caller was authenticated
+	Method string
+	// Scopes are granted to the caller
+	Scopes []string
+	// Tenant is the only tenant the caller reaches, any tenant when empty
+	// for admins, the default tenant for others
+	Tenant string
+}
+
+// HasScope reports whether p was granted scope, ScopeAdmin grants every scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx, if the caller was authenticated
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
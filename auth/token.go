@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// Token types, a refresh token cannot be used as an access token
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// tokenIssuer is the issuer of the tokens, checked when they are verified
+const tokenIssuer = "todo"
+
+// ErrInvalidToken is returned for a malformed, expired or forged token
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims of the tokens issued by a TokenIssuer
+type Claims struct {
+	jwt.RegisteredClaims
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+	Type   string   `json:"typ"`
+}
+
+// Tokens is the pair of tokens returned on login
+type Tokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// TokenIssuer issues and verifies JWTs signed with HMAC-SHA256
+type TokenIssuer struct {
+	key        []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokenIssuer creates a TokenIssuer signing with key. Access tokens
+// are valid for accessTTL, refresh tokens for refreshTTL
+func NewTokenIssuer(key []byte, accessTTL, refreshTTL time.Duration) *TokenIssuer {
+	return &TokenIssuer{
+		key:        key,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// LoadOrCreateSigningKey reads the signing key of path, or generates
+// a random one into path when the file does not exist yet
+func LoadOrCreateSigningKey(path string) ([]byte, error) {
+	bts, err := ioutil.ReadFile(path)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(bts)))
+		if err != nil || len(key) < 32 {
+			return nil, errors.Errorf("invalid signing key file %s", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+	key := make([]byte, 32)
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return key, nil
+}
+
+// Issue issues an access token and a refresh token for u
+func (t *TokenIssuer) Issue(u User) (Tokens, error) {
+	access, err := t.sign(u, TokenAccess, t.accessTTL)
+	if err != nil {
+		return Tokens{}, err
+	}
+	refresh, err := t.sign(u, TokenRefresh, t.refreshTTL)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(t.accessTTL.Seconds()),
+	}, nil
+}
+
+// Verify returns the claims of token when it is valid and of type typ, or ErrInvalidToken
+func (t *TokenIssuer) Verify(token, typ string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return t.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Type != typ {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// Principal returns the principal authenticated by claims
+func (c *Claims) Principal() Principal {
+	return Principal{
+		User:   c.Name,
+		UserID: c.Subject,
+		Method: MethodToken,
+		Scopes: c.Scopes,
+		Tenant: c.Tenant,
+	}
+}
+
+func (t *TokenIssuer) sign(u User, typ string, ttl time.Duration) (string, error) {
+	id, err := randomString(16, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   u.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        id,
+		},
+		Name:   u.Name,
+		Scopes: u.Scopes,
+		Tenant: u.Tenant,
+		Type:   typ,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.key)
+	return signed, errors.WithStack(err)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("0123456789abcdef0123456789abcdef"), time.Minute, time.Hour)
+	u := User{ID: "42", Name: "alice", Scopes: []string{ScopeTodoRead}}
+
+	tokens, err := issuer.Issue(u)
+	assert.Nil(t, err)
+	assert.Equal(t, 60, tokens.ExpiresIn)
+
+	claims, err := issuer.Verify(tokens.AccessToken, TokenAccess)
+	assert.Nil(t, err)
+	p := claims.Principal()
+	assert.Equal(t, "42", p.UserID)
+	assert.Equal(t, "alice", p.User)
+	assert.True(t, p.HasScope(ScopeTodoRead))
+
+	// a refresh token is not an access token
+	_, err = issuer.Verify(tokens.RefreshToken, TokenAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = issuer.Verify(tokens.RefreshToken, TokenRefresh)
+	assert.Nil(t, err)
+
+	// a token signed with another key is rejected
+	other := NewTokenIssuer([]byte("fedcba9876543210fedcba9876543210"), time.Minute, time.Hour)
+	_, err = other.Verify(tokens.AccessToken, TokenAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// an expired token is rejected
+	expired := NewTokenIssuer([]byte("0123456789abcdef0123456789abcdef"), -time.Minute, time.Hour)
+	tokens, _ = expired.Issue(u)
+	_, err = issuer.Verify(tokens.AccessToken, TokenAccess)
+	assert.Equal(t, ErrInvalidToken, err)
+}
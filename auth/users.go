@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the shortest password accepted for an account
+const minPasswordLength = 8
+
+// ErrInvalidCredentials is returned for an unknown user or a wrong password
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// User is an account which can log in with a password.
+// Only the bcrypt hash of the password is stored
+type User struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	PasswordHash string   `json:"passwordHash"`
+	Scopes       []string `json:"scopes"`
+	// Tenant is the tenant the user is bound to, if any
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserStore holds the accounts of a local JSON file.
+// Like KeyStore, the file is read again when it changes
+type UserStore struct {
+	path string
+
+	mu      sync.Mutex
+	users   map[string]User
+	modTime time.Time
+}
+
+// userFile is the on disk representation of a UserStore
+type userFile struct {
+	Users []User `json:"users"`
+}
+
+// LoadUserStore reads the user file path, a missing file holds no user
+func LoadUserStore(path string) (*UserStore, error) {
+	s := &UserStore{
+		path:  path,
+		users: make(map[string]User),
+	}
+	err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create adds a user named name, granted scopes
+func (s *UserStore) Create(name, password string, scopes []string) (User, error) {
+	if name == "" {
+		return User{}, errors.New("a user name is required")
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return User{}, errors.Errorf("unknown scope %q", scope)
+		}
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byName(name); ok {
+		return User{}, errors.Errorf("user %s already exists", name)
+	}
+	u := User{
+		ID:           uuid.New().String(),
+		Name:         name,
+		PasswordHash: hash,
+		Scopes:       scopes,
+		CreatedAt:    time.Now().UTC(),
+	}
+	s.users[u.ID] = u
+	return u, nil
+}
+
+// SetPassword replaces the password of the user named name
+func (s *UserStore) SetPassword(name, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.byName(name)
+	if !ok {
+		return errors.Errorf("user %s not found", name)
+	}
+	u.PasswordHash = hash
+	s.users[u.ID] = u
+	return nil
+}
+
+// SetTenant binds the user named name to tenant, or to no tenant when it is empty
+func (s *UserStore) SetTenant(name, tenantID string) error {
+	if tenantID != "" && !tenant.Valid(tenantID) {
+		return errors.Errorf("invalid tenant %q", tenantID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.byName(name)
+	if !ok {
+		return errors.Errorf("user %s not found", name)
+	}
+	u.Tenant = tenantID
+	s.users[u.ID] = u
+	return nil
+}
+
+// Delete removes the user named name, the todos it owns are kept
+func (s *UserStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.byName(name)
+	if !ok {
+		return errors.Errorf("user %s not found", name)
+	}
+	delete(s.users, u.ID)
+	return nil
+}
+
+// Lookup returns the user named name
+func (s *UserStore) Lookup(name string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.byName(name)
+}
+
+// Get returns the user id, reading the file again when it changed
+func (s *UserStore) Get(id string) (User, error) {
+	err := s.reload()
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, errors.Errorf("user %s not found", id)
+	}
+	return u, nil
+}
+
+// GetByName returns the user named name, reading the file again when it changed
+func (s *UserStore) GetByName(name string) (User, error) {
+	err := s.reload()
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.byName(name)
+	if !ok {
+		return User{}, errors.Errorf("user %s not found", name)
+	}
+	return u, nil
+}
+
+// List returns every user, oldest first
+func (s *UserStore) List() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users
+}
+
+// Save writes the store back to its file, readable by the owner only
+func (s *UserStore) Save() error {
+	bts, err := json.MarshalIndent(userFile{Users: s.List()}, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, bts, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, s.path))
+}
+
+// Authenticate returns the user named name when password matches,
+// or ErrInvalidCredentials
+func (s *UserStore) Authenticate(name, password string) (User, error) {
+	err := s.reload()
+	if err != nil {
+		return User{}, err
+	}
+	u, ok := s.Lookup(name)
+	if !ok {
+		// a hash is still compared, so unknown users take as long as wrong passwords
+		compareDummyHash(password)
+		return User{}, ErrInvalidCredentials
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
+	if err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// byName returns the user named name. The caller holds mu
+func (s *UserStore) byName(name string) (User, bool) {
+	for _, u := range s.users {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// reload reads the user file again when it changed since it was last read
+func (s *UserStore) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !info.ModTime().After(s.modTime) {
+		return nil
+	}
+	bts, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var f userFile
+	err = json.Unmarshal(bts, &f)
+	if err != nil {
+		return errors.Wrapf(err, "invalid user file %s", s.path)
+	}
+	users := make(map[string]User, len(f.Users))
+	for _, u := range f.Users {
+		users[u.ID] = u
+	}
+	s.users = users
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// dummyHash is compared against when a user does not exist
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+func compareDummyHash(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", errors.Errorf("a password must have at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(hash), nil
+}
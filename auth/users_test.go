@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.json")
+
+	admin, _ := LoadUserStore(path)
+	created, err := admin.Create("alice", "correct horse", []string{ScopeTodoRead, ScopeTodoWrite})
+	assert.Nil(t, err)
+	_, err = admin.Create("alice", "correct horse", nil)
+	assert.NotNil(t, err)
+	_, err = admin.Create("bob", "short", nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, admin.Save())
+
+	server, err := LoadUserStore(path)
+	assert.Nil(t, err)
+	u, err := server.Authenticate("alice", "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, u.ID)
+	assert.NotContains(t, u.PasswordHash, "correct horse")
+
+	_, err = server.Authenticate("alice", "wrong horse")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = server.Authenticate("mallory", "correct horse")
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
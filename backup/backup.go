@@ -0,0 +1,184 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Version is the archive format version written by Write
+const Version = 1
+
+// Archive is the content of a backup file.
+// On disk it is stored as gzip compressed JSON
+type Archive struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Count     int           `json:"count"`
+	Checksum  string        `json:"checksum"`
+	Todos     []models.Todo `json:"todos"`
+}
+
+// Write takes a snapshot of every todo in repo and writes it to w
+// as a compressed and checksummed archive.
+// It fails rather than leaving out the records repo cannot decode
+func Write(ctx context.Context, w io.Writer, repo repositories.TodoRepositoryV2) (*Archive, error) {
+	todos, err := repo.GetTodo(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if reporter, ok := repo.(repositories.CorruptRecordReporter); ok {
+		if corrupt := reporter.CorruptRecords(ctx); len(corrupt) > 0 {
+			return nil, errors.Errorf("%d records cannot be decoded, run fsck first: %s", len(corrupt), strings.Join(corrupt, ", "))
+		}
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+	checksum, err := checksum(todos)
+	if err != nil {
+		return nil, err
+	}
+	archive := &Archive{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Count:     len(todos),
+		Checksum:  checksum,
+		Todos:     todos,
+	}
+
+	zw := gzip.NewWriter(w)
+	err = json.NewEncoder(zw).Encode(archive)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return archive, nil
+}
+
+// Read decompresses an archive from r, and verifies its checksum
+// and every record in it
+func Read(r io.Reader) (*Archive, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "archive is not gzip compressed")
+	}
+	defer zr.Close()
+
+	var archive Archive
+	err = json.NewDecoder(zr).Decode(&archive)
+	if err != nil {
+		return nil, errors.Wrap(err, "archive is corrupt")
+	}
+	if archive.Version != Version {
+		return nil, errors.Errorf("unsupported archive version %d", archive.Version)
+	}
+	if archive.Count != len(archive.Todos) {
+		return nil, errors.Errorf("archive declares %d todos but contains %d", archive.Count, len(archive.Todos))
+	}
+	checksum, err := checksum(archive.Todos)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != archive.Checksum {
+		return nil, errors.New("archive checksum mismatch")
+	}
+	err = Validate(archive.Todos)
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// Restore reads an archive from r and, once every record is verified,
+// replaces the content of repo with it in a single transaction, so a failure
+// leaves repo as it was. repo must implement repositories.Transactor.
+// It returns the number of restored todos
+func Restore(ctx context.Context, r io.Reader, repo repositories.TodoRepositoryV2) (int, error) {
+	archive, err := Read(r)
+	if err != nil {
+		return 0, err
+	}
+
+	err = repositories.Transact(ctx, repo, func(tx repositories.TodoRepositoryV2) error {
+		existing, err := tx.GetTodo(ctx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		// collect the ids first, a repository may hand out its own slice
+		ids := make([]uuid.UUID, 0, len(existing))
+		for _, todo := range existing {
+			ids = append(ids, todo.ID)
+		}
+		for _, id := range ids {
+			err = tx.DeleteTodo(ctx, id)
+			if err != nil {
+				return errors.Wrapf(err, "delete todo %s", id)
+			}
+		}
+		for _, todo := range archive.Todos {
+			err = tx.AddTodo(ctx, todo)
+			if err != nil {
+				return errors.Wrapf(err, "restore todo %s", todo.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(archive.Todos), nil
+}
+
+// Validate checks that every todo has an identifier, that identifiers are
+// unique, and that task identifiers are unique within their todo
+func Validate(todos []models.Todo) error {
+	seen := make(map[uuid.UUID]bool, len(todos))
+	for i, todo := range todos {
+		if todo.ID == uuid.Nil {
+			return fmt.Errorf("todo #%d has no id", i)
+		}
+		if seen[todo.ID] {
+			return fmt.Errorf("duplicate todoID %s", todo.ID)
+		}
+		seen[todo.ID] = true
+
+		tasks := make(map[uuid.UUID]bool, len(todo.Tasks))
+		for j, task := range todo.Tasks {
+			if task.ID == uuid.Nil {
+				return fmt.Errorf("task #%d of todo %s has no id", j, todo.ID)
+			}
+			if tasks[task.ID] {
+				return fmt.Errorf("duplicate taskId %s in todo %s", task.ID, todo.ID)
+			}
+			tasks[task.ID] = true
+		}
+	}
+	return nil
+}
+
+// checksum returns the hex encoded SHA-256 of the JSON representation of todos
+func checksum(todos []models.Todo) (string, error) {
+	var buffer bytes.Buffer
+	err := json.NewEncoder(&buffer).Encode(todos)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha256.Sum256(buffer.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
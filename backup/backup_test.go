@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup_WriteRestore(t *testing.T) {
+	repo := repositories.NewMemoryTodoRepository()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		repo.AddTodo(ctx, newTodo())
+	}
+
+	var buffer bytes.Buffer
+	archive, err := Write(ctx, &buffer, repo)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, archive.Count)
+
+	// the restored store only contains the archived todos
+	repo.AddTodo(ctx, newTodo())
+	n, err := Restore(ctx, &buffer, repo)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	list, _ := repo.GetTodo(ctx)
+	assert.ElementsMatch(t, todoIDs(archive.Todos), todoIDs(list))
+}
+
+func TestBackup_Restore_Failure(t *testing.T) {
+	repo := repositories.NewMemoryTodoRepository()
+	ctx := context.Background()
+
+	var buffer bytes.Buffer
+	repo.AddTodo(ctx, newTodo())
+	repo.AddTodo(ctx, newTodo())
+	Write(ctx, &buffer, repo)
+	existing := newTodo()
+	repo.AddTodo(ctx, existing)
+
+	// the second todo of the archive fails, the store is left as it was
+	_, err := Restore(ctx, bytes.NewReader(buffer.Bytes()), &failingRepository{TodoRepositoryV2: repo, failAt: 2})
+	assert.Equal(t, "disk full", errors.Cause(err).Error())
+	list, _ := repo.GetTodo(ctx)
+	assert.Equal(t, 3, len(list))
+
+	// restoring needs a transaction
+	_, err = Restore(ctx, bytes.NewReader(buffer.Bytes()), repositories.NewTodoRepositoryAdapter(repositories.MockTodoRepository{}))
+	assert.Equal(t, repositories.ErrNotTransactional, errors.Cause(err))
+}
+
+func TestBackup_Write_CorruptRecords(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "backup")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	repo := repositories.NewFileStorageTodoRepository(dir)
+	repo.AddTodo(ctx, newTodo())
+	ioutil.WriteFile(filepath.Join(dir, uuid.New().String()), []byte("not a gob"), 0644)
+
+	var buffer bytes.Buffer
+	_, err := Write(ctx, &buffer, repo)
+	assert.NotNil(t, err)
+}
+
+func TestBackup_Read_ChecksumMismatch(t *testing.T) {
+	archive := Archive{
+		Version:  Version,
+		Count:    1,
+		Checksum: "tampered",
+		Todos:    []models.Todo{newTodo()},
+	}
+	var buffer bytes.Buffer
+	zw := gzip.NewWriter(&buffer)
+	json.NewEncoder(zw).Encode(archive)
+	zw.Close()
+
+	_, err := Read(&buffer)
+	assert.NotNil(t, err)
+}
+
+func TestBackup_Validate_DuplicateTask(t *testing.T) {
+	todo := newTodo()
+	todo.Tasks = append(todo.Tasks, todo.Tasks[0])
+
+	err := Validate([]models.Todo{todo})
+	assert.NotNil(t, err)
+}
+
+// failingRepository fails the failAt-th todo added in its transactions
+type failingRepository struct {
+	repositories.TodoRepositoryV2
+	failAt int
+}
+
+func (f *failingRepository) Transact(ctx context.Context, fn func(tx repositories.TodoRepositoryV2) error) error {
+	return repositories.Transact(ctx, f.TodoRepositoryV2, func(tx repositories.TodoRepositoryV2) error {
+		return fn(&failingRepository{TodoRepositoryV2: tx, failAt: f.failAt})
+	})
+}
+
+func (f *failingRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	f.failAt--
+	if f.failAt == 0 {
+		return errors.New("disk full")
+	}
+	return f.TodoRepositoryV2.AddTodo(ctx, todo)
+}
+
+func todoIDs(todos []models.Todo) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, todo := range todos {
+		ids = append(ids, todo.ID)
+	}
+	return ids
+}
+
+func newTodo() models.Todo {
+	return models.Todo{
+		ID:   uuid.New(),
+		Name: "backup",
+		Tasks: []models.Task{
+			{
+				ID:   uuid.New(),
+				Name: "task",
+			},
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package certs
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "tls", "cert.pem")
+	keyFile := filepath.Join(dir, "tls", "key.pem")
+
+	generated, err := GenerateSelfSigned(certFile, keyFile)
+	assert.Nil(t, err)
+	assert.True(t, generated)
+
+	// an existing certificate is kept
+	generated, err = GenerateSelfSigned(certFile, keyFile)
+	assert.Nil(t, err)
+	assert.False(t, generated)
+
+	r, err := NewReloader(certFile, keyFile, time.Minute)
+	assert.Nil(t, err)
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	assert.Nil(t, leaf.VerifyHostname("localhost"))
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	GenerateSelfSigned(certFile, keyFile)
+
+	r, err := NewReloader(certFile, keyFile, time.Nanosecond)
+	assert.Nil(t, err)
+	before, _ := r.GetCertificate(nil)
+
+	// a renewed certificate is served once the files change
+	os.Remove(certFile)
+	GenerateSelfSigned(certFile, keyFile)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	after, _ := r.GetCertificate(nil)
+	assert.NotEqual(t, before.Certificate[0], after.Certificate[0])
+
+	// a broken certificate is not served
+	ioutil.WriteFile(certFile, []byte("broken"), 0644)
+	later = later.Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	kept, _ := r.GetCertificate(nil)
+	assert.Equal(t, after.Certificate[0], kept.Certificate[0])
+}
@@ -0,0 +1,95 @@
+package certs
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reloader serves the certificate of a certificate and key file pair,
+// and reloads it when either file changes, so a renewed certificate
+// is picked up without restarting the server
+type Reloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	loadedAt time.Time
+	checked  time.Time
+}
+
+// NewReloader loads the certificate of certFile and keyFile.
+// The files are checked for changes at most once per interval
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	modTime, err := r.modTime()
+	if err != nil {
+		return nil, err
+	}
+	err = r.load(modTime)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, it is meant for tls.Config.GetCertificate.
+// When a changed certificate cannot be loaded, such as while the files are being
+// replaced, the previous certificate is served until the next check
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < r.interval {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	modTime, err := r.modTime()
+	if err == nil && modTime.After(r.loadedAt) {
+		err = r.load(modTime)
+		if err == nil {
+			slog.Info("reloaded TLS certificate", "certFile", r.certFile)
+		}
+	}
+	if err != nil {
+		slog.Warn("reloading TLS certificate", "certFile", r.certFile, "error", err)
+	}
+	return r.cert, nil
+}
+
+// load loads the key pair. The caller holds mu, or owns r
+func (r *Reloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	r.cert = &cert
+	r.loadedAt = modTime
+	return nil
+}
+
+// modTime returns the latest modification time of the certificate and key files
+func (r *Reloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, errors.WithStack(err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
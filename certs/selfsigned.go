@@ -0,0 +1,89 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// selfSignedValidity is the lifetime of a generated certificate
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// GenerateSelfSigned writes a self-signed certificate and its key to certFile and keyFile,
+// unless certFile already exists. The certificate is valid for localhost, the loopback
+// addresses and the host name. It reports whether the files were generated.
+// It is meant for development, clients have to trust the certificate explicitly
+func GenerateSelfSigned(certFile, keyFile string) (bool, error) {
+	_, err := os.Stat(certFile)
+	if err == nil {
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, errors.WithStack(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "todo self-signed", Organization: []string{"todo"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, err := os.Hostname(); err == nil && host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	// the key is written first, so an existing certificate always has its key
+	err = writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600)
+	if err != nil {
+		return false, err
+	}
+	err = writePEM(certFile, "CERTIFICATE", der, 0644)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writePEM writes a single PEM block to name, creating its directory
+func writePEM(name, blockType string, der []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return errors.WithStack(ioutil.WriteFile(name, data, perm))
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/backup"
+	"github.com/elumbantoruan/todo/config"
+	"github.com/elumbantoruan/todo/encryption"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/pkg/errors"
+)
+
+// runCommand runs the maintenance command name with its arguments
+func runCommand(name string, args []string) error {
+	switch name {
+	case "backup":
+		return runBackup(args)
+	case "restore":
+		return runRestore(args)
+	case "fsck":
+		return runFsck(args)
+	case "rotate-keys":
+		return runRotateKeys(args)
+	case "apikey":
+		return runAPIKey(args)
+	case "user":
+		return runUser(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// runBackup writes an archive of the data directory to a file, or to stdout
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	resolveStorage, err := storageFlags(fs, "key file for encrypted records")
+	if err != nil {
+		return err
+	}
+	out := fs.String("out", "", "archive file, stdout when empty")
+	fs.Parse(args)
+	storage, err := resolveStorage()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	repo, err := newReadOnlyFileStorage(storage)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	archive, err := backup.Write(context.Background(), w, repo)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "backed up %d todos, sha256 %s\n", archive.Count, archive.Checksum)
+	return nil
+}
+
+// runRestore verifies an archive and replaces the content of the data directory with it
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	resolveStorage, err := storageFlags(fs, "key file for encrypted records")
+	if err != nil {
+		return err
+	}
+	in := fs.String("in", "", "archive file, stdin when empty")
+	fs.Parse(args)
+	storage, err := resolveStorage()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	repo, err := newFileStorage(storage)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	n, err := backup.Restore(context.Background(), r, repo)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "restored %d todos\n", n)
+	return nil
+}
+
+// runFsck verifies every record of the data directory and quarantines the bad ones
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	resolveStorage, err := storageFlags(fs, "key file for encrypted records")
+	if err != nil {
+		return err
+	}
+	quarantine := fs.String("quarantine", "quarantine", "directory receiving bad records and the report")
+	dryRun := fs.Bool("dry-run", false, "report bad records without moving them")
+	fs.Parse(args)
+	storage, err := resolveStorage()
+	if err != nil {
+		return err
+	}
+
+	dir := *quarantine
+	if *dryRun {
+		dir = ""
+	}
+
+	repo, err := newFileStorage(storage)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	report, err := repo.Verify(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Problems {
+		fmt.Fprintf(os.Stdout, "%s: %s\n", p.Key, p.Reason)
+	}
+	fmt.Fprintf(os.Stderr, "checked %d records, %d bad\n", report.Checked, len(report.Problems))
+	if len(report.Problems) > 0 {
+		if *dryRun {
+			return fmt.Errorf("%d bad records found", len(report.Problems))
+		}
+		fmt.Fprintf(os.Stderr, "bad records moved into %s\n", dir)
+	}
+	return nil
+}
+
+// runRotateKeys adds a new active key to the key file and re-encrypts
+// every record of the data directory with it
+func runRotateKeys(args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	resolveStorage, err := storageFlags(fs, "key file, created when it does not exist")
+	if err != nil {
+		return err
+	}
+	fs.Parse(args)
+	storage, err := resolveStorage()
+	if err != nil {
+		return err
+	}
+
+	if storage.KeyFile == "" {
+		return errors.New("a key file is required")
+	}
+	keyring, err := encryption.LoadOrCreateKeyring(storage.KeyFile)
+	if err != nil {
+		return err
+	}
+	// no key is added while the server holds the data directory
+	repo := repositories.NewFileStorageTodoRepositoryWithOptions(repositories.FileStorageOptions{
+		Path:         storage.DataDir,
+		CacheSizeMax: storage.CacheSizeMax,
+		Keyring:      keyring,
+	})
+	err = repo.Lock()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	id, err := keyring.Rotate()
+	if err != nil {
+		return err
+	}
+	// the key is saved before any record is sealed with it
+	err = keyring.Save()
+	if err != nil {
+		return err
+	}
+	n, err := repo.Reencrypt()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "active key %s, re-encrypted %d records\n", id, n)
+	return nil
+}
+
+// runAPIKey creates, revokes or lists the API keys of the API key file
+func runAPIKey(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: apikey create|revoke|list [flags]")
+	}
+	cfg, err := config.Load(nil, nil, os.Getenv)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ExitOnError)
+	file := fs.String("file", cfg.Auth.APIKeyFile, "API key file")
+
+	switch args[0] {
+	case "create":
+		name := fs.String("name", "", "name of the caller using the key")
+		scopes := fs.String("scopes", auth.ScopeTodoRead, "comma separated scopes: todo:read, todo:write, admin")
+		user := fs.String("user", "", "user acting through the key, the key owns its todos when empty")
+		tenantID := fs.String("tenant", "", "tenant the key is bound to, with tenancy enabled")
+		fs.Parse(args[1:])
+		if *name == "" {
+			return errors.New("a name is required")
+		}
+		var userID string
+		if *user != "" {
+			users, err := auth.LoadUserStore(cfg.Auth.UserFile)
+			if err != nil {
+				return err
+			}
+			u, ok := users.Lookup(*user)
+			if !ok {
+				return errors.Errorf("user %s not found", *user)
+			}
+			userID = u.ID
+		}
+		keys, err := auth.LoadKeyStore(*file)
+		if err != nil {
+			return err
+		}
+		key, k, err := keys.Create(*name, userID, strings.Split(*scopes, ","))
+		if err != nil {
+			return err
+		}
+		if *tenantID != "" {
+			err = keys.SetTenant(k.ID, *tenantID)
+			if err != nil {
+				return err
+			}
+		}
+		err = keys.Save()
+		if err != nil {
+			return err
+		}
+		// the key cannot be recovered, it is only printed now
+		fmt.Fprintln(os.Stdout, key)
+		fmt.Fprintf(os.Stderr, "created API key %s for %s with scopes %s\n", k.ID, k.Name, strings.Join(k.Scopes, ","))
+		return nil
+	case "revoke":
+		id := fs.String("id", "", "id of the key to revoke")
+		fs.Parse(args[1:])
+		keys, err := auth.LoadKeyStore(*file)
+		if err != nil {
+			return err
+		}
+		err = keys.Revoke(*id)
+		if err != nil {
+			return err
+		}
+		err = keys.Save()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "revoked API key %s\n", *id)
+		return nil
+	case "list":
+		fs.Parse(args[1:])
+		keys, err := auth.LoadKeyStore(*file)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys.List() {
+			status := "active"
+			if k.RevokedAt != nil {
+				status = "revoked " + k.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, strings.Join(k.Scopes, ","),
+				k.CreatedAt.Format(time.RFC3339), status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown apikey command %q", args[0])
+	}
+}
+
+// runUser creates, deletes or lists the accounts of the user file, or changes their password.
+// Passwords are read from the first line of stdin, so they do not show in the process list
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: user create|passwd|delete|list [flags]")
+	}
+	cfg, err := config.Load(nil, nil, os.Getenv)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	file := fs.String("file", cfg.Auth.UserFile, "user file")
+	name := fs.String("name", "", "user name")
+	var scopes, tenantID *string
+	if args[0] == "create" {
+		scopes = fs.String("scopes", auth.ScopeTodoRead+","+auth.ScopeTodoWrite, "comma separated scopes: todo:read, todo:write, admin")
+		tenantID = fs.String("tenant", "", "tenant the user is bound to, with tenancy enabled")
+	}
+	fs.Parse(args[1:])
+
+	users, err := auth.LoadUserStore(*file)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "create":
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		u, err := users.Create(*name, password, strings.Split(*scopes, ","))
+		if err != nil {
+			return err
+		}
+		if *tenantID != "" {
+			err = users.SetTenant(u.Name, *tenantID)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "created user %s (%s) with scopes %s\n", u.Name, u.ID, strings.Join(u.Scopes, ","))
+	case "passwd":
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		err = users.SetPassword(*name, password)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "changed the password of %s\n", *name)
+	case "delete":
+		err = users.Delete(*name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "deleted user %s, the todos it owns are kept\n", *name)
+	case "list":
+		for _, u := range users.List() {
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\t%s\n", u.ID, u.Name, strings.Join(u.Scopes, ","), u.Tenant, u.CreatedAt.Format(time.RFC3339))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown user command %q", args[0])
+	}
+	return users.Save()
+}
+
+// readPassword reads a password from the first line of stdin
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// storageFlags defines the data, keys and tenant flags of a command on fs, defaulting
+// to the file storage of the configuration file and the environment.
+// Once fs is parsed, the returned function gives the storage of the command:
+// with tenancy, the directory of the tenant in the data directory, as the server uses it
+func storageFlags(fs *flag.FlagSet, keysUsage string) (func() (config.FileStorage, error), error) {
+	cfg, err := config.Load(nil, nil, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	storage := cfg.Storage.File
+	fs.StringVar(&storage.DataDir, "data", storage.DataDir, "data directory")
+	fs.StringVar(&storage.KeyFile, "keys", storage.KeyFile, keysUsage)
+	tenantID := fs.String("tenant", "", "tenant whose storage is used, the default tenant when empty")
+	return func() (config.FileStorage, error) {
+		if !cfg.Tenancy.Enabled {
+			if *tenantID != "" {
+				return storage, errors.New("-tenant requires tenancy to be enabled")
+			}
+			return storage, nil
+		}
+		id := *tenantID
+		if id == "" {
+			id = cfg.Tenancy.DefaultTenant
+		}
+		if !tenant.Valid(id) {
+			return storage, errors.Errorf("invalid tenant %q", id)
+		}
+		storage.DataDir = filepath.Join(storage.DataDir, id)
+		return storage, nil
+	}, nil
+}
+
+// newFileStorage creates the file storage configured by storage,
+// encrypted with the keys of its key file when it is set.
+// The data directory stays locked until the storage is closed, so the server
+// and the maintenance commands never write it at the same time
+func newFileStorage(storage config.FileStorage) (*repositories.FileStorageTodoRepository, error) {
+	repo, err := openFileStorage(storage)
+	if err != nil {
+		return nil, err
+	}
+	err = repo.Lock()
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// newReadOnlyFileStorage creates the file storage configured by storage, for commands
+// which only read it: they lock the data directory together, but never along with the
+// server or the commands writing it
+func newReadOnlyFileStorage(storage config.FileStorage) (*repositories.FileStorageTodoRepository, error) {
+	repo, err := openFileStorage(storage)
+	if err != nil {
+		return nil, err
+	}
+	err = repo.LockShared()
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// openFileStorage creates the file storage configured by storage, without locking it
+func openFileStorage(storage config.FileStorage) (*repositories.FileStorageTodoRepository, error) {
+	opts := repositories.FileStorageOptions{
+		Path:         storage.DataDir,
+		CacheSizeMax: storage.CacheSizeMax,
+	}
+	if storage.KeyFile != "" {
+		keyring, err := encryption.LoadKeyring(storage.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Keyring = keyring
+	}
+	return repositories.NewFileStorageTodoRepositoryWithOptions(opts), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBackup_Tenancy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	t.Setenv("TODO_DATA_DIR", dir)
+	t.Setenv("TODO_TENANCY_ENABLED", "true")
+
+	todo := models.Todo{ID: uuid.New(), Name: "acme"}
+	acme := repositories.NewFileStorageTodoRepository(filepath.Join(dir, "acme"))
+	acme.AddTodo(ctx, todo)
+	globex := repositories.NewFileStorageTodoRepository(filepath.Join(dir, "globex"))
+	globex.AddTodo(ctx, models.Todo{ID: uuid.New(), Name: "globex"})
+	globex.AddTodo(ctx, models.Todo{ID: uuid.New(), Name: "globex"})
+
+	// the archive of acme holds its todos only, and restores into the default tenant
+	archive := filepath.Join(dir, "acme.json.gz")
+	err := runBackup([]string{"-tenant", "acme", "-out", archive})
+	assert.Nil(t, err)
+	err = runRestore([]string{"-in", archive})
+	assert.Nil(t, err)
+
+	list, err := repositories.NewFileStorageTodoRepository(filepath.Join(dir, "default")).GetTodo(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, todo.ID, list[0].ID)
+	list, err = globex.GetTodo(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+
+	err = runFsck([]string{"-tenant", "../globex", "-dry-run"})
+	assert.NotNil(t, err)
+}
+
+func TestRunBackup_Lock(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	t.Setenv("TODO_DATA_DIR", filepath.Join(dir, "data"))
+	archive := filepath.Join(dir, "todo.json.gz")
+
+	// backups run together, but not along with the server
+	reader := repositories.NewFileStorageTodoRepository(filepath.Join(dir, "data"))
+	assert.Nil(t, reader.LockShared())
+	assert.Nil(t, runBackup([]string{"-out", archive}))
+	assert.Nil(t, reader.Close())
+
+	server := repositories.NewFileStorageTodoRepository(filepath.Join(dir, "data"))
+	assert.Nil(t, server.Lock())
+	err := runBackup([]string{"-out", archive})
+	assert.Equal(t, repositories.ErrLocked, errors.Cause(err))
+	assert.Nil(t, server.Close())
+}
+
+func TestRunBackup_TenantWithoutTenancy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	t.Setenv("TODO_DATA_DIR", dir)
+
+	err := runBackup([]string{"-tenant", "acme", "-out", filepath.Join(dir, "acme.json.gz")})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/elumbantoruan/todo/tracing"
+	"github.com/pkg/errors"
+)
+
+// Storage backends
+const (
+	// BackendFile stores one file per todo in a data directory
+	BackendFile = "file"
+	// BackendMemory keeps todos in memory, they are lost on restart
+	BackendMemory = "memory"
+)
+
+// TLS client authentication modes
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone = "none"
+	// ClientAuthRequest verifies a client certificate when one is given
+	ClientAuthRequest = "request"
+	// ClientAuthRequire rejects connections without a valid client certificate
+	ClientAuthRequire = "require"
+)
+
+// Config is the configuration of the server
+type Config struct {
+	Server      Server      `yaml:"server" toml:"server"`
+	Storage     Storage     `yaml:"storage" toml:"storage"`
+	Repository  Repository  `yaml:"repository" toml:"repository"`
+	Tracing     Tracing     `yaml:"tracing" toml:"tracing"`
+	Auth        Auth        `yaml:"auth" toml:"auth"`
+	Tenancy     Tenancy     `yaml:"tenancy" toml:"tenancy"`
+	Limits      Limits      `yaml:"limits" toml:"limits"`
+	Idempotency Idempotency `yaml:"idempotency" toml:"idempotency"`
+}
+
+// Server configures the http server
+type Server struct {
+	// Addr is the listen address
+	Addr string `yaml:"addr" toml:"addr"`
+	// ReadHeaderTimeout bounds the time to read the headers of a request
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" toml:"readHeaderTimeout"`
+	// ShutdownTimeout bounds the time given to in-flight requests on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+	TLS             TLS           `yaml:"tls" toml:"tls"`
+}
+
+// TLS configures HTTPS, the server serves plain HTTP when CertFile is empty
+type TLS struct {
+	CertFile string `yaml:"certFile" toml:"certFile"`
+	KeyFile  string `yaml:"keyFile" toml:"keyFile"`
+	// SelfSigned generates a self-signed certificate into CertFile
+	// and KeyFile on first start, for development
+	SelfSigned bool `yaml:"selfSigned" toml:"selfSigned"`
+	// ReloadInterval is how often the certificate files are checked for changes
+	ReloadInterval time.Duration `yaml:"reloadInterval" toml:"reloadInterval"`
+	// ClientAuth is ClientAuthNone, ClientAuthRequest or ClientAuthRequire
+	ClientAuth string `yaml:"clientAuth" toml:"clientAuth"`
+	// ClientCAFile holds the PEM certificates of the CAs issuing client certificates
+	ClientCAFile string `yaml:"clientCAFile" toml:"clientCAFile"`
+	// ClientUsers maps the subject of a client certificate, such as "CN=ci,O=acme",
+	// to a user. The common name is the user when the subject is not listed
+	ClientUsers map[string]string `yaml:"clientUsers,omitempty" toml:"clientUsers,omitempty"`
+	// ClientScopes are granted to the callers authenticated by a client certificate
+	ClientScopes []string `yaml:"clientScopes" toml:"clientScopes"`
+}
+
+// Enabled reports whether the server serves HTTPS
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Storage selects the storage backend and its options
+type Storage struct {
+	// Backend is BackendFile or BackendMemory
+	Backend string      `yaml:"backend" toml:"backend"`
+	File    FileStorage `yaml:"file" toml:"file"`
+	Cache   Cache       `yaml:"cache" toml:"cache"`
+}
+
+// FileStorage configures the file backend
+type FileStorage struct {
+	// DataDir is the folder storing one file per todo
+	DataDir string `yaml:"dataDir" toml:"dataDir"`
+	// KeyFile encrypts records at rest when set
+	KeyFile string `yaml:"keyFile" toml:"keyFile"`
+	// CacheSizeMax is the size in bytes of the in-memory cache of raw records
+	CacheSizeMax uint64 `yaml:"cacheSizeMax" toml:"cacheSizeMax"`
+}
+
+// Cache bounds the cache of decoded todos in front of the backend
+type Cache struct {
+	// Entries is the number of cached todos, 0 disables the cache
+	Entries int `yaml:"entries" toml:"entries"`
+	// TTL is the lifetime of a cached todo, 0 never expires them
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// Repository enables the repository middlewares
+type Repository struct {
+	Logging bool `yaml:"logging" toml:"logging"`
+	Metrics bool `yaml:"metrics" toml:"metrics"`
+	// Tracing defaults to whether spans are exported
+	Tracing *bool `yaml:"tracing,omitempty" toml:"tracing,omitempty"`
+}
+
+// Tracing selects the span exporter
+type Tracing struct {
+	// Exporter is one of the tracing exporters
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// File is written by the file exporter
+	File string `yaml:"file" toml:"file"`
+}
+
+// Auth configures the authentication of the API
+type Auth struct {
+	// Enabled requires the callers of the todo and backup routes to be
+	// authenticated and granted the scope of the route
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// APIKeyFile holds the API keys managed by the apikey commands
+	APIKeyFile string `yaml:"apiKeyFile" toml:"apiKeyFile"`
+	// UserFile holds the accounts managed by the user commands
+	UserFile string `yaml:"userFile" toml:"userFile"`
+	// SigningKeyFile holds the key signing the tokens, generated on first start
+	SigningKeyFile string `yaml:"signingKeyFile" toml:"signingKeyFile"`
+	// AccessTokenTTL is the lifetime of the access tokens issued on login
+	AccessTokenTTL time.Duration `yaml:"accessTokenTTL" toml:"accessTokenTTL"`
+	// RefreshTokenTTL is the lifetime of the refresh tokens issued on login
+	RefreshTokenTTL time.Duration `yaml:"refreshTokenTTL" toml:"refreshTokenTTL"`
+}
+
+// Tenancy configures workspaces: each tenant gets its own data directory,
+// or its own memory store, created on its first request
+type Tenancy struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Header names the tenant of a request
+	Header string `yaml:"header" toml:"header"`
+	// Domain, when set, lets the subdomain of the host name the tenant,
+	// such as acme for acme.todo.example.com when Domain is todo.example.com
+	Domain string `yaml:"domain" toml:"domain"`
+	// DefaultTenant is the tenant of the requests naming none
+	DefaultTenant string `yaml:"defaultTenant" toml:"defaultTenant"`
+	// MaxTodos is the number of todos of a tenant, 0 does not limit them
+	MaxTodos int `yaml:"maxTodos" toml:"maxTodos"`
+	// MaxTasks is the number of tasks of all the todos of a tenant, 0 does not limit them
+	MaxTasks int `yaml:"maxTasks" toml:"maxTasks"`
+}
+
+// Limits protects the API from misbehaving callers
+type Limits struct {
+	// Rate is the number of requests per second of a caller, the authenticated
+	// user or API key or else the client IP, 0 does not limit them
+	Rate float64 `yaml:"rate" toml:"rate"`
+	// Burst is the number of requests a caller makes at once
+	Burst int `yaml:"burst" toml:"burst"`
+	// Routes overrides Rate and Burst per route, keyed by method and path
+	// template such as "POST /v1/todo"
+	Routes map[string]RateLimit `yaml:"routes,omitempty" toml:"routes,omitempty"`
+	// MaxBodyBytes is the size in bytes of request bodies
+	MaxBodyBytes uint64 `yaml:"maxBodyBytes" toml:"maxBodyBytes"`
+	// MaxTasksPerTodo is the number of tasks of a todo, 0 does not limit them
+	MaxTasksPerTodo int `yaml:"maxTasksPerTodo" toml:"maxTasksPerTodo"`
+	// MaxBatchOperations is the number of operations of a batch
+	MaxBatchOperations int `yaml:"maxBatchOperations" toml:"maxBatchOperations"`
+}
+
+// RateLimit is the rate limit of a route
+type RateLimit struct {
+	// Rate is the number of requests per second of a caller, 0 does not limit them
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+// Idempotency configures the Idempotency-Key header of the POST routes
+type Idempotency struct {
+	// TTL is how long the response to a request with a key is replayed to its retries
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":5000",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			TLS: TLS{
+				ReloadInterval: 10 * time.Second,
+				ClientAuth:     ClientAuthNone,
+				ClientScopes:   []string{auth.ScopeTodoRead, auth.ScopeTodoWrite},
+			},
+		},
+		Storage: Storage{
+			Backend: BackendFile,
+			File: FileStorage{
+				DataDir:      "data",
+				CacheSizeMax: 1024 * 1024,
+			},
+			Cache: Cache{
+				Entries: 1000,
+				TTL:     time.Minute,
+			},
+		},
+		Repository: Repository{
+			Metrics: true,
+		},
+		Tracing: Tracing{
+			Exporter: tracing.ExporterNone,
+		},
+		Auth: Auth{
+			Enabled:         true,
+			APIKeyFile:      "apikeys.json",
+			UserFile:        "users.json",
+			SigningKeyFile:  "signing.key",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+		},
+		Tenancy: Tenancy{
+			Header:        tenant.Header,
+			DefaultTenant: "default",
+		},
+		Limits: Limits{
+			Rate:               20,
+			Burst:              40,
+			MaxBodyBytes:       1024 * 1024,
+			MaxTasksPerTodo:    1000,
+			MaxBatchOperations: 100,
+		},
+		Idempotency: Idempotency{
+			TTL: 24 * time.Hour,
+		},
+	}
+}
+
+// TracingEnabled reports whether repository calls are traced
+func (r Repository) TracingEnabled(t Tracing) bool {
+	if r.Tracing != nil {
+		return *r.Tracing
+	}
+	return t.Exporter != "" && t.Exporter != tracing.ExporterNone
+}
+
+// Describe names the storage selected by s, such as for the version endpoint
+func (s Storage) Describe() string {
+	if s.Backend == BackendFile && s.File.KeyFile != "" {
+		return "file (encrypted)"
+	}
+	return s.Backend
+}
+
+// Validate returns an error listing every invalid setting of c
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.ReadHeaderTimeout > 0, "server.readHeaderTimeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout must be positive")
+
+	tls := c.Server.TLS
+	check((tls.CertFile == "") == (tls.KeyFile == ""), "server.tls.certFile and server.tls.keyFile are set together")
+	check(!tls.SelfSigned || tls.Enabled(), "server.tls.selfSigned requires server.tls.certFile and server.tls.keyFile")
+	check(tls.ReloadInterval > 0, "server.tls.reloadInterval must be positive")
+	switch tls.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		check(tls.Enabled(), "server.tls.clientAuth requires server.tls.certFile")
+		check(tls.ClientCAFile != "", "server.tls.clientAuth requires server.tls.clientCAFile")
+	default:
+		check(false, "server.tls.clientAuth %q is not one of %s, %s, %s",
+			tls.ClientAuth, ClientAuthNone, ClientAuthRequest, ClientAuthRequire)
+	}
+
+	for _, scope := range tls.ClientScopes {
+		check(auth.ValidScope(scope), "server.tls.clientScopes: unknown scope %q", scope)
+	}
+
+	switch c.Storage.Backend {
+	case BackendFile:
+		check(c.Storage.File.DataDir != "", "storage.file.dataDir is required by the file backend")
+	case BackendMemory:
+		check(c.Storage.File.KeyFile == "", "storage.file.keyFile is not supported by the memory backend")
+	default:
+		check(false, "storage.backend %q is not one of %s, %s", c.Storage.Backend, BackendFile, BackendMemory)
+	}
+	check(c.Storage.Cache.Entries >= 0, "storage.cache.entries must not be negative")
+	check(c.Storage.Cache.TTL >= 0, "storage.cache.ttl must not be negative")
+
+	switch c.Tracing.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file is required by the file exporter")
+	default:
+		check(false, "tracing.exporter %q is not one of %s, %s, %s",
+			c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterFile)
+	}
+
+	if c.Auth.Enabled {
+		check(c.Auth.APIKeyFile != "", "auth.apiKeyFile is required when auth is enabled")
+		check(c.Auth.UserFile != "", "auth.userFile is required when auth is enabled")
+		check(c.Auth.SigningKeyFile != "", "auth.signingKeyFile is required when auth is enabled")
+		check(c.Auth.AccessTokenTTL > 0, "auth.accessTokenTTL must be positive")
+		check(c.Auth.RefreshTokenTTL >= c.Auth.AccessTokenTTL, "auth.refreshTokenTTL must not be shorter than auth.accessTokenTTL")
+	}
+
+	if c.Tenancy.Enabled {
+		check(c.Tenancy.Header != "", "tenancy.header is required when tenancy is enabled")
+		check(tenant.Valid(c.Tenancy.DefaultTenant), "tenancy.defaultTenant %q is not a valid tenant", c.Tenancy.DefaultTenant)
+	}
+	check(c.Tenancy.MaxTodos >= 0, "tenancy.maxTodos must not be negative")
+	check(c.Tenancy.MaxTasks >= 0, "tenancy.maxTasks must not be negative")
+
+	check(c.Limits.Rate >= 0, "limits.rate must not be negative")
+	check(c.Limits.Rate == 0 || c.Limits.Burst >= 1, "limits.burst must be at least 1")
+	for route, limit := range c.Limits.Routes {
+		check(len(strings.Fields(route)) == 2, "limits.routes: %q is not a method and a path template", route)
+		check(limit.Rate >= 0, "limits.routes: rate of %q must not be negative", route)
+		check(limit.Rate == 0 || limit.Burst >= 1, "limits.routes: burst of %q must be at least 1", route)
+	}
+	check(c.Limits.MaxBodyBytes > 0, "limits.maxBodyBytes must be positive")
+	check(c.Limits.MaxTasksPerTodo >= 0, "limits.maxTasksPerTodo must not be negative")
+	check(c.Limits.MaxBatchOperations >= 1, "limits.maxBatchOperations must be at least 1")
+	check(c.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
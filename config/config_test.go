@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "todo.yaml")
+	ioutil.WriteFile(file, []byte(`
+server:
+  addr: ":6000"
+  shutdownTimeout: 5s
+storage:
+  file:
+    dataDir: from-file
+  cache:
+    entries: 10
+`), 0644)
+	env := map[string]string{
+		FileEnv:              file,
+		"TODO_DATA_DIR":      "from-env",
+		"TODO_CACHE_ENTRIES": "20",
+	}
+
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	cfg, err := Load(fs, []string{"-cache-entries", "30"}, func(name string) string { return env[name] })
+	assert.Nil(t, err)
+	assert.Equal(t, ":6000", cfg.Server.Addr)
+	assert.Equal(t, 5*time.Second, cfg.Server.ShutdownTimeout)
+	assert.Equal(t, "from-env", cfg.Storage.File.DataDir)
+	assert.Equal(t, 30, cfg.Storage.Cache.Entries)
+	// defaults are kept for what is not set
+	assert.Equal(t, time.Minute, cfg.Storage.Cache.TTL)
+	assert.False(t, cfg.Repository.TracingEnabled(cfg.Tracing))
+}
+
+func TestLoad_TOML(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "todo.toml")
+	ioutil.WriteFile(file, []byte(`
+[storage]
+backend = "memory"
+
+[storage.cache]
+ttl = "30s"
+
+[repository]
+tracing = true
+`), 0644)
+
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	cfg, err := Load(fs, []string{"-config", file}, func(string) string { return "" })
+	assert.Nil(t, err)
+	assert.Equal(t, BackendMemory, cfg.Storage.Backend)
+	assert.Equal(t, 30*time.Second, cfg.Storage.Cache.TTL)
+	assert.True(t, cfg.Repository.TracingEnabled(cfg.Tracing))
+}
+
+func TestLoad_UnknownSetting(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "todo.yaml")
+	ioutil.WriteFile(file, []byte("server:\n  adr: \":6000\"\n"), 0644)
+
+	_, err := Load(nil, nil, func(name string) string {
+		if name == FileEnv {
+			return file
+		}
+		return ""
+	})
+	assert.NotNil(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := Default()
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Storage.Backend = "sql"
+	cfg.Tracing.Exporter = "file"
+	cfg.Tenancy.Enabled = true
+	cfg.Tenancy.DefaultTenant = "Acme Corp"
+	err := cfg.Validate()
+	assert.Contains(t, err.Error(), "storage.backend")
+	assert.Contains(t, err.Error(), "tracing.file")
+	assert.Contains(t, err.Error(), "tenancy.defaultTenant")
+}
+
+func TestConfig_WriteYAML(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "todo.yaml")
+
+	// the printed configuration loads back to the same configuration
+	cfg := Default()
+	cfg.Storage.Cache.TTL = 90 * time.Second
+	var buffer bytes.Buffer
+	assert.Nil(t, cfg.WriteYAML(&buffer))
+	ioutil.WriteFile(file, buffer.Bytes(), 0644)
+
+	loaded, err := Load(nil, nil, func(name string) string {
+		if name == FileEnv {
+			return file
+		}
+		return ""
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, cfg, loaded)
+}
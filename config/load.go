@@ -0,0 +1,278 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the path of the configuration file,
+// the -config flag takes precedence over it
+const FileEnv = "TODO_CONFIG"
+
+// setting is a configuration field settable by a flag and an environment variable
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+// settings returns the settings bound to the fields of c
+func settings(c *Config) []setting {
+	return []setting{
+		{"addr", "TODO_ADDR", "listen address", (*stringValue)(&c.Server.Addr)},
+		{"read-header-timeout", "TODO_READ_HEADER_TIMEOUT", "time to read the headers of a request", (*durationValue)(&c.Server.ReadHeaderTimeout)},
+		{"shutdown-timeout", "TODO_SHUTDOWN_TIMEOUT", "time given to in-flight requests on shutdown", (*durationValue)(&c.Server.ShutdownTimeout)},
+		{"tls-cert", "TODO_TLS_CERT", "certificate file, HTTPS is served when set", (*stringValue)(&c.Server.TLS.CertFile)},
+		{"tls-key", "TODO_TLS_KEY", "key file of the certificate", (*stringValue)(&c.Server.TLS.KeyFile)},
+		{"tls-self-signed", "TODO_TLS_SELF_SIGNED", "generate a self-signed certificate on first start, for development", (*boolValue)(&c.Server.TLS.SelfSigned)},
+		{"tls-reload-interval", "TODO_TLS_RELOAD_INTERVAL", "how often the certificate files are checked for changes", (*durationValue)(&c.Server.TLS.ReloadInterval)},
+		{"tls-client-auth", "TODO_TLS_CLIENT_AUTH", "client certificate authentication, none, request or require", (*stringValue)(&c.Server.TLS.ClientAuth)},
+		{"tls-client-ca", "TODO_TLS_CLIENT_CA", "CA certificates of client certificates", (*stringValue)(&c.Server.TLS.ClientCAFile)},
+		{"storage", "TODO_STORAGE_BACKEND", "storage backend, file or memory", (*stringValue)(&c.Storage.Backend)},
+		{"data", "TODO_DATA_DIR", "data directory of the file backend", (*stringValue)(&c.Storage.File.DataDir)},
+		{"keys", "TODO_KEY_FILE", "key file, records are encrypted at rest when set", (*stringValue)(&c.Storage.File.KeyFile)},
+		{"disk-cache-size", "TODO_DISK_CACHE_SIZE", "size in bytes of the cache of raw records of the file backend", (*uint64Value)(&c.Storage.File.CacheSizeMax)},
+		{"cache-entries", "TODO_CACHE_ENTRIES", "number of cached todos, 0 disables the cache", (*intValue)(&c.Storage.Cache.Entries)},
+		{"cache-ttl", "TODO_CACHE_TTL", "lifetime of a cached todo, 0 never expires them", (*durationValue)(&c.Storage.Cache.TTL)},
+		{"repo-logging", "TODO_REPO_LOGGING", "log every repository call", (*boolValue)(&c.Repository.Logging)},
+		{"repo-metrics", "TODO_REPO_METRICS", "record the latency of repository calls", (*boolValue)(&c.Repository.Metrics)},
+		{"repo-tracing", "TODO_REPO_TRACING", "trace repository calls, whenever spans are exported by default", optionalBoolValue{&c.Repository.Tracing}},
+		{"tracing-exporter", "TODO_TRACING_EXPORTER", "span exporter, none, stdout or file", (*stringValue)(&c.Tracing.Exporter)},
+		{"tracing-file", "TODO_TRACING_FILE", "file written by the file exporter", (*stringValue)(&c.Tracing.File)},
+		{"auth", "TODO_AUTH_ENABLED", "require authentication on the todo and backup routes", (*boolValue)(&c.Auth.Enabled)},
+		{"api-key-file", "TODO_API_KEY_FILE", "file holding the API keys", (*stringValue)(&c.Auth.APIKeyFile)},
+		{"user-file", "TODO_USER_FILE", "file holding the user accounts", (*stringValue)(&c.Auth.UserFile)},
+		{"signing-key-file", "TODO_SIGNING_KEY_FILE", "file holding the key signing the tokens, generated on first start", (*stringValue)(&c.Auth.SigningKeyFile)},
+		{"access-token-ttl", "TODO_ACCESS_TOKEN_TTL", "lifetime of the access tokens", (*durationValue)(&c.Auth.AccessTokenTTL)},
+		{"refresh-token-ttl", "TODO_REFRESH_TOKEN_TTL", "lifetime of the refresh tokens", (*durationValue)(&c.Auth.RefreshTokenTTL)},
+		{"tenancy", "TODO_TENANCY_ENABLED", "give each tenant its own storage", (*boolValue)(&c.Tenancy.Enabled)},
+		{"tenant-header", "TODO_TENANT_HEADER", "http header naming the tenant of a request", (*stringValue)(&c.Tenancy.Header)},
+		{"tenant-domain", "TODO_TENANT_DOMAIN", "domain whose subdomains name the tenant of a request", (*stringValue)(&c.Tenancy.Domain)},
+		{"default-tenant", "TODO_DEFAULT_TENANT", "tenant of the requests naming none", (*stringValue)(&c.Tenancy.DefaultTenant)},
+		{"tenant-max-todos", "TODO_TENANT_MAX_TODOS", "number of todos of a tenant, 0 does not limit them", (*intValue)(&c.Tenancy.MaxTodos)},
+		{"tenant-max-tasks", "TODO_TENANT_MAX_TASKS", "number of tasks of a tenant, 0 does not limit them", (*intValue)(&c.Tenancy.MaxTasks)},
+		{"rate-limit", "TODO_RATE_LIMIT", "requests per second of a caller, 0 does not limit them", (*float64Value)(&c.Limits.Rate)},
+		{"rate-limit-burst", "TODO_RATE_LIMIT_BURST", "requests a caller makes at once", (*intValue)(&c.Limits.Burst)},
+		{"max-body-bytes", "TODO_MAX_BODY_BYTES", "size in bytes of request bodies", (*uint64Value)(&c.Limits.MaxBodyBytes)},
+		{"max-tasks-per-todo", "TODO_MAX_TASKS_PER_TODO", "number of tasks of a todo, 0 does not limit them", (*intValue)(&c.Limits.MaxTasksPerTodo)},
+		{"max-batch-operations", "TODO_MAX_BATCH_OPERATIONS", "number of operations of a batch", (*intValue)(&c.Limits.MaxBatchOperations)},
+		{"idempotency-ttl", "TODO_IDEMPOTENCY_TTL", "how long responses are replayed to retries with the same Idempotency-Key", (*durationValue)(&c.Idempotency.TTL)},
+	}
+}
+
+// Load loads the configuration from, in increasing order of precedence,
+// the defaults, the configuration file, the TODO_* environment variables
+// and the flags in args, then validates it.
+// The flags are registered on fs, which may define flags of its own.
+// A nil fs only reads the configuration file and the environment
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+	bound := settings(&cfg)
+
+	// flags are parsed first to find the configuration file,
+	// and applied last since they take precedence
+	var (
+		file    = getenv(FileEnv)
+		flagged []flagged
+	)
+	if fs != nil {
+		fs.Func("config", "configuration file, YAML or TOML (env "+FileEnv+")", func(s string) error {
+			file = s
+			return nil
+		})
+		for _, s := range bound {
+			fs.Var(&recordedValue{target: s.value, name: s.flag, flagged: &flagged},
+				s.flag, s.usage+" (env "+s.env+")")
+		}
+		err := fs.Parse(args)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	if file != "" {
+		err := loadFile(file, &cfg)
+		if err != nil {
+			return cfg, err
+		}
+	}
+	for _, s := range bound {
+		if v := getenv(s.env); v != "" {
+			err := s.value.Set(v)
+			if err != nil {
+				return cfg, errors.Wrap(err, s.env)
+			}
+		}
+	}
+	for _, f := range flagged {
+		err := f.target.Set(f.value)
+		if err != nil {
+			return cfg, errors.Wrap(err, "-"+f.name)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile decodes the YAML or TOML file path into cfg, according to its extension.
+// Unknown keys are rejected, so a misspelled setting is not silently ignored
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if err == io.EOF {
+			return nil
+		}
+		return errors.Wrap(err, path)
+	case ".toml":
+		md, err := toml.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return errors.Errorf("%s: unknown setting %s", path, undecoded[0])
+		}
+		return nil
+	default:
+		return errors.Errorf("%s: unsupported configuration format, expected .yaml, .yml or .toml", path)
+	}
+}
+
+// WriteYAML writes c as YAML, in the format of the configuration file
+func (c Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err := enc.Encode(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(enc.Close())
+}
+
+// flagged is a flag given on the command line, applied once the other sources are loaded
+type flagged struct {
+	name   string
+	value  string
+	target flag.Value
+}
+
+// recordedValue records the flags set on the command line, so they are set again
+// over the configuration file and the environment
+type recordedValue struct {
+	target  flag.Value
+	name    string
+	flagged *[]flagged
+}
+
+func (r *recordedValue) String() string {
+	if r == nil || r.target == nil {
+		return ""
+	}
+	return r.target.String()
+}
+
+func (r *recordedValue) Set(s string) error {
+	// setting the target now reports an invalid flag with the usage,
+	// it is set again once the other sources are loaded
+	err := r.target.Set(s)
+	if err != nil {
+		return err
+	}
+	*r.flagged = append(*r.flagged, flagged{name: r.name, value: s, target: r.target})
+	return nil
+}
+
+func (r *recordedValue) IsBoolFlag() bool {
+	b, ok := r.target.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+type stringValue string
+
+func (s *stringValue) Set(v string) error { *s = stringValue(v); return nil }
+func (s *stringValue) String() string     { return string(*s) }
+
+type durationValue time.Duration
+
+func (d *durationValue) Set(v string) error {
+	parsed, err := time.ParseDuration(v)
+	*d = durationValue(parsed)
+	return err
+}
+func (d *durationValue) String() string { return time.Duration(*d).String() }
+
+type intValue int
+
+func (i *intValue) Set(v string) error {
+	parsed, err := strconv.Atoi(v)
+	*i = intValue(parsed)
+	return err
+}
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+
+type uint64Value uint64
+
+func (u *uint64Value) Set(v string) error {
+	parsed, err := strconv.ParseUint(v, 10, 64)
+	*u = uint64Value(parsed)
+	return err
+}
+func (u *uint64Value) String() string { return strconv.FormatUint(uint64(*u), 10) }
+
+type float64Value float64
+
+func (f *float64Value) Set(v string) error {
+	parsed, err := strconv.ParseFloat(v, 64)
+	*f = float64Value(parsed)
+	return err
+}
+func (f *float64Value) String() string { return strconv.FormatFloat(float64(*f), 'g', -1, 64) }
+
+type boolValue bool
+
+func (b *boolValue) Set(v string) error {
+	parsed, err := strconv.ParseBool(v)
+	*b = boolValue(parsed)
+	return err
+}
+func (b *boolValue) String() string   { return strconv.FormatBool(bool(*b)) }
+func (b *boolValue) IsBoolFlag() bool { return true }
+
+// optionalBoolValue sets a *bool, which stays nil until set
+type optionalBoolValue struct {
+	b **bool
+}
+
+func (o optionalBoolValue) Set(v string) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*o.b = &parsed
+	return nil
+}
+func (o optionalBoolValue) String() string {
+	if o.b == nil || *o.b == nil {
+		return ""
+	}
+	return strconv.FormatBool(**o.b)
+}
+func (o optionalBoolValue) IsBoolFlag() bool { return true }
@@ -0,0 +1,296 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the size in bytes of the AES-256 keys held by a Keyring
+const KeySize = 32
+
+// magic prefixes every sealed record so it can be told apart from plaintext.
+// Records of version 1 did not authenticate their header, they are still opened
+var (
+	magic   = []byte("TODOENC2")
+	magicV1 = []byte("TODOENC1")
+)
+
+// Keyring holds the key encryption keys loaded from a local key file.
+// Records are sealed with envelope encryption: each record is encrypted
+// with a fresh data key, which is itself encrypted with the active key.
+// The id of that key is stored in the record header so the record
+// can still be opened after the active key is rotated, and the header
+// is authenticated along with the data key and the record
+type Keyring struct {
+	path   string
+	active string
+	keys   map[string][]byte
+}
+
+// keyFile is the on disk representation of a Keyring
+type keyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// LoadKeyring reads a key file
+func LoadKeyring(path string) (*Keyring, error) {
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var kf keyFile
+	err = json.Unmarshal(bts, &kf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid key file %s", path)
+	}
+
+	kr := &Keyring{
+		path:   path,
+		active: kf.Active,
+		keys:   make(map[string][]byte, len(kf.Keys)),
+	}
+	for id, encoded := range kf.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", id)
+		}
+		if len(key) != KeySize {
+			return nil, errors.Errorf("key %s must be %d bytes", id, KeySize)
+		}
+		kr.keys[id] = key
+	}
+	if _, ok := kr.keys[kr.active]; !ok {
+		return nil, errors.Errorf("active key %q not found in %s", kr.active, path)
+	}
+	return kr, nil
+}
+
+// LoadOrCreateKeyring reads a key file, or creates an empty keyring bound to path
+// when the file does not exist yet
+func LoadOrCreateKeyring(path string) (*Keyring, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return &Keyring{
+			path: path,
+			keys: make(map[string][]byte),
+		}, nil
+	}
+	return LoadKeyring(path)
+}
+
+// ActiveKeyID returns the id of the key used to seal new records
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// Rotate generates a new key and makes it the active key.
+// Previous keys are kept so existing records can still be opened
+func (k *Keyring) Rotate() (string, error) {
+	key := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	id := time.Now().UTC().Format("20060102T150405Z")
+	if _, ok := k.keys[id]; ok {
+		return "", errors.Errorf("key %s already exists", id)
+	}
+	k.keys[id] = key
+	k.active = id
+	return id, nil
+}
+
+// Save writes the keyring back to its key file, readable by the owner only
+func (k *Keyring) Save() error {
+	kf := keyFile{
+		Active: k.active,
+		Keys:   make(map[string]string, len(k.keys)),
+	}
+	for id, key := range k.keys {
+		kf.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+	bts, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := k.path + ".tmp"
+	err = ioutil.WriteFile(tmp, bts, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, k.path))
+}
+
+// IsSealed reports whether record was produced by Seal
+func IsSealed(record []byte) bool {
+	return bytes.HasPrefix(record, magic) || bytes.HasPrefix(record, magicV1)
+}
+
+// IsCurrent reports whether record was produced by Seal with the active key
+// of k, in the current record version
+func (k *Keyring) IsCurrent(record []byte) bool {
+	h, err := parseHeader(record)
+	return err == nil && h.version == 2 && h.keyID == k.active
+}
+
+// KeyID returns the id of the key a sealed record was encrypted with
+func KeyID(record []byte) (string, error) {
+	h, err := parseHeader(record)
+	if err != nil {
+		return "", err
+	}
+	return h.keyID, nil
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the active key.
+// The record layout is
+// magic | key id length (1 byte) | key id | wrapped data key | nonce | ciphertext
+// and the header, up to the key id, is the additional data of both the wrapped
+// data key and the ciphertext
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	kek, ok := k.keys[k.active]
+	if !ok {
+		return nil, errors.New("keyring has no active key")
+	}
+
+	dek := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, dek)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var buffer bytes.Buffer
+	buffer.Write(magic)
+	buffer.WriteByte(byte(len(k.active)))
+	buffer.WriteString(k.active)
+	aad := buffer.Bytes()
+
+	wrapped, err := seal(kek, dek, aad)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dek, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	buffer.Write(wrapped)
+	buffer.Write(ciphertext)
+	return buffer.Bytes(), nil
+}
+
+// Open decrypts a record produced by Seal with any key of the keyring
+func (k *Keyring) Open(record []byte) ([]byte, error) {
+	h, err := parseHeader(record)
+	if err != nil {
+		return nil, err
+	}
+	kek, ok := k.keys[h.keyID]
+	if !ok {
+		return nil, errors.Errorf("unknown key %q", h.keyID)
+	}
+	dek, err := open(kek, h.wrapped, h.aad)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap data key")
+	}
+	plaintext, err := open(dek, h.ciphertext, h.aad)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt record")
+	}
+	return plaintext, nil
+}
+
+// header is a parsed sealed record
+type header struct {
+	version int
+	keyID   string
+	// aad is the authenticated header, nil for version 1
+	aad        []byte
+	wrapped    []byte
+	ciphertext []byte
+}
+
+// wrappedSize is the size of a data key sealed by seal
+const wrappedSize = 12 + KeySize + 16
+
+func parseHeader(record []byte) (*header, error) {
+	if !IsSealed(record) {
+		return nil, errors.New("record is not encrypted")
+	}
+	version := 2
+	if bytes.HasPrefix(record, magicV1) {
+		version = 1
+	}
+	rest := record[len(magic):]
+	if len(rest) < 1 {
+		return nil, errors.New("truncated record header")
+	}
+	n := int(rest[0])
+	rest = rest[1:]
+	if len(rest) < n+wrappedSize {
+		return nil, errors.New("truncated record header")
+	}
+	h := &header{
+		version:    version,
+		keyID:      string(rest[:n]),
+		wrapped:    rest[n : n+wrappedSize],
+		ciphertext: rest[n+wrappedSize:],
+	}
+	if version == 2 {
+		h.aad = record[:len(magic)+1+n]
+	}
+	return h, nil
+}
+
+// seal encrypts plaintext with AES-GCM and authenticates aad along with it,
+// the random nonce is prepended
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts the output of seal
+func open(key, sealed, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,106 @@
+package encryption
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring_SealOpen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keys")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+
+	keyring, err := LoadOrCreateKeyring(path)
+	assert.Nil(t, err)
+	_, err = keyring.Seal([]byte("todo"))
+	assert.NotNil(t, err)
+
+	first, err := keyring.Rotate()
+	assert.Nil(t, err)
+	record, err := keyring.Seal([]byte("todo"))
+	assert.Nil(t, err)
+	assert.True(t, IsSealed(record))
+	assert.True(t, keyring.IsCurrent(record))
+	assert.False(t, bytes.Contains(record, []byte("todo")))
+	keyID, _ := KeyID(record)
+	assert.Equal(t, first, keyID)
+
+	// records sealed with a previous key are still opened once saved and loaded
+	keyring.keys["next"] = bytes.Repeat([]byte{1}, KeySize)
+	keyring.active = "next"
+	assert.Nil(t, keyring.Save())
+	keyring, err = LoadKeyring(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "next", keyring.ActiveKeyID())
+	assert.False(t, keyring.IsCurrent(record))
+	plaintext, err := keyring.Open(record)
+	assert.Nil(t, err)
+	assert.Equal(t, "todo", string(plaintext))
+
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestKeyring_Open_Tampered(t *testing.T) {
+	keyring := &Keyring{
+		active: "a",
+		keys: map[string][]byte{
+			"a": bytes.Repeat([]byte{1}, KeySize),
+		},
+	}
+	record, _ := keyring.Seal([]byte("todo"))
+
+	// every byte is authenticated, including the header
+	for _, i := range []int{len(magic), len(magic) + 1, len(record) - 1} {
+		tampered := append([]byte{}, record...)
+		tampered[i]++
+		_, err := keyring.Open(tampered)
+		assert.NotNil(t, err, "byte %d", i)
+	}
+	_, err := keyring.Open(record[:len(magic)+2])
+	assert.NotNil(t, err)
+	_, err = keyring.Open([]byte("plaintext"))
+	assert.NotNil(t, err)
+}
+
+func TestKeyring_Open_Version1(t *testing.T) {
+	kek := bytes.Repeat([]byte{1}, KeySize)
+	dek := bytes.Repeat([]byte{2}, KeySize)
+	keyring := &Keyring{active: "a", keys: map[string][]byte{"a": kek}}
+
+	// version 1 records do not authenticate their header
+	wrapped, _ := seal(kek, dek, nil)
+	ciphertext, _ := seal(dek, []byte("todo"), nil)
+	record := append(append(append([]byte{}, magicV1...), 1, 'a'), wrapped...)
+	record = append(record, ciphertext...)
+
+	assert.True(t, IsSealed(record))
+	assert.False(t, keyring.IsCurrent(record))
+	plaintext, err := keyring.Open(record)
+	assert.Nil(t, err)
+	assert.Equal(t, "todo", string(plaintext))
+}
+
+func TestLoadKeyring_Invalid(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keys")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+
+	for _, content := range []string{
+		`not json`,
+		`{"active":"a","keys":{"a":"not base64"}}`,
+		`{"active":"a","keys":{"a":"c2hvcnQ="}}`,
+		`{"active":"b","keys":{}}`,
+	} {
+		ioutil.WriteFile(path, []byte(content), 0600)
+		_, err := LoadKeyring(path)
+		assert.NotNil(t, err, content)
+	}
+	_, err := LoadKeyring(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
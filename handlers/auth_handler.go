@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/elumbantoruan/todo/auth"
+)
+
+// AuthHandler handles login and token refresh
+type AuthHandler struct {
+	users  *auth.UserStore
+	tokens *auth.TokenIssuer
+}
+
+// NewAuthHandler creates an instance of AuthHandler
+func NewAuthHandler(users *auth.UserStore, tokens *auth.TokenIssuer) *AuthHandler {
+	return &AuthHandler{
+		users:  users,
+		tokens: tokens,
+	}
+}
+
+// loginRequest is the payload of a login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// refreshRequest is the payload of a token refresh
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// HandleLogin handles http POST action to log in with a username and a password,
+// it responds with an access token and a refresh token
+func (a *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "AuthHandler.HandleLogin")
+	defer span.End()
+	defer r.Body.Close()
+
+	var req loginRequest
+	err := decode(ctx, r.Body, &req)
+	if err != nil || req.Username == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	u, err := a.users.Authenticate(req.Username, req.Password)
+	if err == auth.ErrInvalidCredentials {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.writeTokens(ctx, w, u)
+}
+
+// HandleRefresh handles http POST action to exchange a refresh token for new tokens.
+// The user is looked up again, so a deleted user cannot refresh its tokens
+// and changed scopes are picked up
+func (a *AuthHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "AuthHandler.HandleRefresh")
+	defer span.End()
+	defer r.Body.Close()
+
+	var req refreshRequest
+	err := decode(ctx, r.Body, &req)
+	if err != nil || req.RefreshToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	claims, err := a.tokens.Verify(req.RefreshToken, auth.TokenRefresh)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	u, err := a.users.Get(claims.Subject)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	a.writeTokens(ctx, w, u)
+}
+
+// writeTokens responds with new tokens for u, which must not be cached
+func (a *AuthHandler) writeTokens(ctx context.Context, w http.ResponseWriter, u auth.User) {
+	tokens, err := a.tokens.Issue(u)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(ctx, w, http.StatusOK, tokens)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthHandler_LoginRefresh(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+	users, _ := auth.LoadUserStore(filepath.Join(dir, "users.json"))
+	users.Create("alice", "correct horse", []string{auth.ScopeTodoRead})
+	tokens := auth.NewTokenIssuer([]byte("0123456789abcdef0123456789abcdef"), time.Minute, time.Hour)
+	handle := NewAuthHandler(users, tokens)
+
+	req := httptest.NewRequest("POST", "/v1/auth/login", strings.NewReader(`{"username":"alice","password":"wrong horse"}`))
+	rr := httptest.NewRecorder()
+	handle.HandleLogin(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req = httptest.NewRequest("POST", "/v1/auth/login", strings.NewReader(`{"username":"alice","password":"correct horse"}`))
+	rr = httptest.NewRecorder()
+	handle.HandleLogin(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var issued auth.Tokens
+	json.NewDecoder(rr.Body).Decode(&issued)
+	_, err := tokens.Verify(issued.AccessToken, auth.TokenAccess)
+	assert.Nil(t, err)
+
+	// an access token cannot be used to refresh
+	req = httptest.NewRequest("POST", "/v1/auth/refresh", strings.NewReader(`{"refreshToken":"`+issued.AccessToken+`"}`))
+	rr = httptest.NewRecorder()
+	handle.HandleRefresh(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req = httptest.NewRequest("POST", "/v1/auth/refresh", strings.NewReader(`{"refreshToken":"`+issued.RefreshToken+`"}`))
+	rr = httptest.NewRecorder()
+	handle.HandleRefresh(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/elumbantoruan/todo/backup"
+	"github.com/elumbantoruan/todo/repositories"
+)
+
+// BackupHandler handles backup API operations
+type BackupHandler struct {
+	repo repositories.TodoRepositoryV2
+}
+
+// NewBackupHandler creates an instance of BackupHandler
+func NewBackupHandler(repo repositories.TodoRepositoryV2) *BackupHandler {
+	return &BackupHandler{
+		repo: repo,
+	}
+}
+
+// HandleGetBackup handles http GET action to download a backup archive
+// of every todo while the server keeps running
+func (b *BackupHandler) HandleGetBackup(w http.ResponseWriter, r *http.Request) {
+	// the archive is buffered so a failure can still be reported as 500
+	var buffer bytes.Buffer
+	archive, err := backup.Write(r.Context(), &buffer, b.repo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	filename := fmt.Sprintf("todo-%s.json.gz", archive.CreatedAt.Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+	w.Header().Set("X-Backup-Checksum", archive.Checksum)
+	w.WriteHeader(http.StatusOK)
+	buffer.WriteTo(w)
+}
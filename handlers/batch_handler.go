@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elumbantoruan/todo/metrics"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+)
+
+// errBatchFailed rolls back an atomic batch once one of its operations failed
+var errBatchFailed = errors.New("batch operation failed")
+
+// BatchHandler applies batches of operations on todos and tasks
+type BatchHandler struct {
+	repo          repositories.TodoRepositoryV2
+	maxOperations int
+}
+
+// NewBatchHandler creates an instance of BatchHandler accepting
+// batches of up to maxOperations operations
+func NewBatchHandler(repo repositories.TodoRepositoryV2, maxOperations int) *BatchHandler {
+	return &BatchHandler{
+		repo:          repo,
+		maxOperations: maxOperations,
+	}
+}
+
+// HandleBatch handles http POST action applying a batch of operations in order.
+// Every operation is applied and gets its own result, unless the batch is atomic:
+// an atomic batch stops at the first failed operation and none of its operations is
+// kept, it gets 409, or 501 when the repository does not support transactions
+func (b *BatchHandler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "BatchHandler.HandleBatch")
+	defer span.End()
+	defer r.Body.Close()
+
+	var batch models.BatchRequest
+	err := decode(ctx, r.Body, &batch)
+	if err != nil {
+		writeDecodeError(ctx, w, err)
+		return
+	}
+	if len(batch.Operations) > b.maxOperations {
+		writeJSON(ctx, w, http.StatusBadRequest, &models.ValidationError{Errors: []models.FieldError{
+			{Field: "operations", Message: fmt.Sprintf("must be at most %d operations, not %d", b.maxOperations, len(batch.Operations))},
+		}})
+		return
+	}
+
+	if !batch.Atomic {
+		response := models.BatchResponse{Committed: true}
+		for _, op := range batch.Operations {
+			result, completed := apply(ctx, b.repo, op)
+			response.Results = append(response.Results, result)
+			if completed {
+				metrics.TasksCompleted.Inc()
+			}
+		}
+		writeJSON(ctx, w, http.StatusOK, response)
+		return
+	}
+
+	var (
+		response models.BatchResponse
+		// completions are only counted once the transaction is committed
+		completions int
+	)
+	err = repositories.Transact(ctx, b.repo, func(tx repositories.TodoRepositoryV2) error {
+		for _, op := range batch.Operations {
+			result, completed := apply(ctx, tx, op)
+			response.Results = append(response.Results, result)
+			if result.Status >= http.StatusBadRequest {
+				return errBatchFailed
+			}
+			if completed {
+				completions++
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		metrics.TasksCompleted.Add(float64(completions))
+		response.Committed = true
+		writeJSON(ctx, w, http.StatusOK, response)
+	case errors.Cause(err) == errBatchFailed:
+		writeJSON(ctx, w, http.StatusConflict, response)
+	case errors.Cause(err) == repositories.ErrNotTransactional:
+		w.WriteHeader(http.StatusNotImplemented)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// apply applies op to repo, and returns the result the route of the operation would respond
+// and whether it completed a task which was not completed
+func apply(ctx context.Context, repo repositories.TodoRepositoryV2, op models.BatchOperation) (models.BatchResult, bool) {
+	var (
+		result    models.BatchResult
+		completed bool
+		err       error
+	)
+	switch op.Op {
+	case models.OpCreateTodo:
+		todo := *op.Todo
+		prepareTodo(ctx, &todo)
+		err = repo.AddTodo(ctx, todo)
+		result = models.BatchResult{Status: http.StatusCreated, ID: todo.ID.String(), Location: todoLocation(todo.ID)}
+	case models.OpAddTask:
+		task := *op.Task
+		prepareTask(ctx, &task)
+		err = repo.AddTask(ctx, op.TodoID, task)
+		result = models.BatchResult{Status: http.StatusCreated, ID: task.ID.String(), Location: taskLocation(op.TodoID, task.ID)}
+	case models.OpCompleteTask:
+		var todo *models.Todo
+		todo, err = repo.GetTodoByID(ctx, op.TodoID)
+		if err != nil {
+			break
+		}
+		task := findTask(todo, op.TaskID)
+		if task == nil {
+			return models.BatchResult{Status: http.StatusNotFound, Error: http.StatusText(http.StatusNotFound)}, false
+		}
+		completed = op.Completed && !task.Completed
+		err = repo.UpdateTask(ctx, op.TodoID, op.TaskID, op.Completed, userID(ctx))
+		result = models.BatchResult{Status: http.StatusOK}
+	case models.OpUpdateTodo:
+		err = repo.UpdateTodo(ctx, op.TodoID, op.Completed, op.DueDate)
+		result = models.BatchResult{Status: http.StatusNoContent}
+	case models.OpDeleteTodo:
+		err = repo.DeleteTodo(ctx, op.TodoID)
+		result = models.BatchResult{Status: http.StatusNoContent}
+	case models.OpDeleteTask:
+		err = repo.DeleteTask(ctx, op.TodoID, op.TaskID)
+		result = models.BatchResult{Status: http.StatusNoContent}
+	}
+	if err != nil {
+		status := errorStatus(err)
+		return models.BatchResult{Status: status, Error: http.StatusText(status)}, false
+	}
+	return result, completed
+}
+
+// errorStatus returns the http status of a repository error
+func errorStatus(err error) int {
+	switch {
+	case isForbidden(err):
+		return http.StatusForbidden
+	case strings.Contains(err.Error(), "no such file"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "duplicate todoID"), strings.Contains(err.Error(), "duplicate taskId"):
+		return http.StatusConflict
+	case isTooManyTasks(err):
+		return http.StatusUnprocessableEntity
+	case isQuotaExceeded(err):
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
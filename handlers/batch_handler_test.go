@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elumbantoruan/todo/metrics"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchHandler_HandleBatch(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryTodoRepository()
+	todo := newTodo()
+	repo.AddTodo(ctx, todo)
+	h := NewBatchHandler(repo, 3)
+
+	do := func(payload string) (int, models.BatchResponse) {
+		request, _ := http.NewRequest("POST", "/v1/batch", strings.NewReader(payload))
+		responseRecorder := httptest.NewRecorder()
+		h.HandleBatch(responseRecorder, request)
+		var response models.BatchResponse
+		json.NewDecoder(responseRecorder.Body).Decode(&response)
+		return responseRecorder.Code, response
+	}
+	list := func() int {
+		todoList, _ := repo.GetTodo(ctx)
+		return len(todoList)
+	}
+
+	// every operation is applied and gets its result
+	code, response := do(fmt.Sprintf(`{"operations":[
+		{"op":"createTodo","todo":{"name":"plan"}},
+		{"op":"addTask","todoId":%q,"task":{"name":"step"}},
+		{"op":"deleteTodo","todoId":%q}]}`, todo.ID, uuid.New()))
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, response.Committed)
+	if assert.Equal(t, 3, len(response.Results)) {
+		assert.Equal(t, http.StatusCreated, response.Results[0].Status)
+		assert.Equal(t, "/v1/todo/"+response.Results[0].ID, response.Results[0].Location)
+		assert.Equal(t, http.StatusCreated, response.Results[1].Status)
+		assert.Equal(t, http.StatusNotFound, response.Results[2].Status)
+	}
+	assert.Equal(t, 2, list())
+
+	// an atomic batch is rolled back at the first failure
+	code, response = do(fmt.Sprintf(`{"atomic":true,"operations":[
+		{"op":"deleteTodo","todoId":%q},
+		{"op":"completeTask","todoId":%q,"taskId":%q,"completed":true}]}`, todo.ID, todo.ID, todo.Tasks[0].ID))
+	assert.Equal(t, http.StatusConflict, code)
+	assert.False(t, response.Committed)
+	if assert.Equal(t, 2, len(response.Results)) {
+		assert.Equal(t, http.StatusNoContent, response.Results[0].Status)
+		assert.Equal(t, http.StatusNotFound, response.Results[1].Status)
+	}
+	assert.Equal(t, 2, list())
+
+	// completions of a rolled back batch are not counted
+	completed := testutil.ToFloat64(metrics.TasksCompleted)
+	code, _ = do(fmt.Sprintf(`{"atomic":true,"operations":[
+		{"op":"completeTask","todoId":%q,"taskId":%q,"completed":true},
+		{"op":"deleteTodo","todoId":%q}]}`, todo.ID, todo.Tasks[0].ID, uuid.New()))
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, completed, testutil.ToFloat64(metrics.TasksCompleted))
+
+	code, response = do(fmt.Sprintf(`{"atomic":true,"operations":[
+		{"op":"completeTask","todoId":%q,"taskId":%q,"completed":true},
+		{"op":"createTodo","todo":{"name":"next"}}]}`, todo.ID, todo.Tasks[0].ID))
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, response.Committed)
+	assert.Equal(t, 3, list())
+	stored, _ := repo.GetTodoByID(ctx, todo.ID)
+	assert.True(t, stored.Tasks[0].Completed)
+	assert.Equal(t, completed+1, testutil.ToFloat64(metrics.TasksCompleted))
+
+	// batches are validated and capped
+	code, _ = do(`{"operations":[{"op":"archive"},{"op":"addTask","task":{"name":""}}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(`{"operations":[{"op":"deleteTodo","todoId":"` + uuid.New().String() + `"},{"op":"deleteTodo","todoId":"` + uuid.New().String() +
+		`"},{"op":"deleteTodo","todoId":"` + uuid.New().String() + `"},{"op":"deleteTodo","todoId":"` + uuid.New().String() + `"}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestBatchHandler_HandleBatch_NotTransactional(t *testing.T) {
+	mockRepo := repositories.MockTodoRepository{}
+	mockRepo.Clear()
+	h := NewBatchHandler(repositories.NewTodoRepositoryAdapter(mockRepo), 10)
+
+	request, _ := http.NewRequest("POST", "/v1/batch", strings.NewReader(`{"atomic":true,"operations":[{"op":"createTodo","todo":{"name":"plan"}}]}`))
+	responseRecorder := httptest.NewRecorder()
+	h.HandleBatch(responseRecorder, request)
+
+	assert.Equal(t, http.StatusNotImplemented, responseRecorder.Code)
+}
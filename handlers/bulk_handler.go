@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/elumbantoruan/todo/tenant"
+)
+
+// confirmationTTL is how long the confirmation token of a dry run is valid
+const confirmationTTL = 5 * time.Minute
+
+// BulkHandler applies an action to every todo matching the filter of GET /v1/todo
+type BulkHandler struct {
+	repo repositories.TodoRepositoryV2
+	// key signs the confirmation tokens, they do not survive a restart
+	key []byte
+	now func() time.Time
+}
+
+// NewBulkHandler creates an instance of BulkHandler
+func NewBulkHandler(repo repositories.TodoRepositoryV2) (*BulkHandler, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &BulkHandler{
+		repo: repo,
+		key:  key,
+		now:  time.Now,
+	}, nil
+}
+
+// HandleBulk handles http POST action applying an action to the todos selected by
+// the search, skip and limit parameters, and returns their ids and the result of each.
+// A dry run only returns the ids, with a confirmation token when the action is
+// destructive or selects the todos without a search. Such an action needs the token of
+// a dry run selecting the same todos: it gets 428 without one, and 409 when the token
+// expired or the todos changed.
+// The todos are selected and updated in a transaction when the repository supports them
+func (b *BulkHandler) HandleBulk(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "BulkHandler.HandleBulk")
+	defer span.End()
+	defer r.Body.Close()
+
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var req models.BulkRequest
+	err = decode(ctx, r.Body, &req)
+	if err != nil {
+		writeDecodeError(ctx, w, err)
+		return
+	}
+
+	var (
+		status   int
+		response *models.BulkResponse
+	)
+	bulk := func(repo repositories.TodoRepositoryV2) error {
+		var err error
+		status, response, err = b.bulk(ctx, repo, filter, req)
+		return err
+	}
+	err = repositories.Transact(ctx, b.repo, bulk)
+	if errors.Cause(err) == repositories.ErrNotTransactional {
+		err = bulk(b.repo)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if response == nil {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(ctx, w, status, response)
+}
+
+// bulk selects the todos of repo matching filter and applies the action of req to them,
+// it returns the status and the response, nil when the status has no body
+func (b *BulkHandler) bulk(ctx context.Context, repo repositories.TodoRepositoryV2, filter todoFilter, req models.BulkRequest) (int, *models.BulkResponse, error) {
+	todoList, err := selectTodos(ctx, repo, filter)
+	if err != nil {
+		return 0, nil, err
+	}
+	confirm := req.Destructive() || filter.selectsAll()
+	response := &models.BulkResponse{
+		Action: req.Action,
+		DryRun: req.DryRun,
+		IDs:    make([]uuid.UUID, 0, len(todoList)),
+	}
+	for _, todo := range todoList {
+		response.IDs = append(response.IDs, todo.ID)
+	}
+
+	if req.DryRun {
+		if confirm {
+			expires := b.now().Add(confirmationTTL).UTC().Truncate(time.Second)
+			response.ConfirmationToken = b.sign(ctx, req, response.IDs, expires)
+			response.ExpiresAt = &expires
+		}
+		return http.StatusOK, response, nil
+	}
+	if confirm {
+		if req.ConfirmationToken == "" {
+			return http.StatusPreconditionRequired, nil, nil
+		}
+		if !b.verify(ctx, req, response.IDs) {
+			return http.StatusConflict, nil, nil
+		}
+	}
+
+	for _, todo := range todoList {
+		response.Results = append(response.Results, applyBulk(ctx, repo, req, todo))
+	}
+	return http.StatusOK, response, nil
+}
+
+// selectTodos returns the todos of repo selected by filter, the todos GET /v1/todo lists
+func selectTodos(ctx context.Context, repo repositories.TodoRepositoryV2, filter todoFilter) ([]models.Todo, error) {
+	todoList, err := repo.GetTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(todoList), nil
+}
+
+// applyBulk applies the action of req to todo, and returns the result its own route would respond
+func applyBulk(ctx context.Context, repo repositories.TodoRepositoryV2, req models.BulkRequest, todo models.Todo) models.BatchResult {
+	var err error
+	switch req.Action {
+	case models.BulkComplete:
+		err = repo.UpdateTodo(ctx, todo.ID, true, todo.DueDate)
+	case models.BulkReopen:
+		err = repo.UpdateTodo(ctx, todo.ID, false, todo.DueDate)
+	case models.BulkSetDueDate:
+		err = repo.UpdateTodo(ctx, todo.ID, todo.Completed, req.DueDate)
+	case models.BulkAddTag:
+		err = repo.TagTodo(ctx, todo.ID, req.Tag)
+	case models.BulkArchive:
+		err = repo.ArchiveTodo(ctx, todo.ID, true)
+	case models.BulkDelete:
+		err = repo.DeleteTodo(ctx, todo.ID)
+	}
+	if err != nil {
+		status := errorStatus(err)
+		return models.BatchResult{Status: status, ID: todo.ID.String(), Error: http.StatusText(status)}
+	}
+	return models.BatchResult{Status: http.StatusNoContent, ID: todo.ID.String()}
+}
+
+// sign returns the confirmation token of the action of req on the todos ids by the caller
+// of ctx, valid until expires. The token is the expiry followed by the signature
+func (b *BulkHandler) sign(ctx context.Context, req models.BulkRequest, ids []uuid.UUID, expires time.Time) string {
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	return unix + "." + hex.EncodeToString(b.mac(ctx, req, ids, unix))
+}
+
+// verify reports whether the confirmation token of req confirms the action of req
+// on the todos ids by the caller of ctx, and has not expired
+func (b *BulkHandler) verify(ctx context.Context, req models.BulkRequest, ids []uuid.UUID) bool {
+	parts := strings.SplitN(req.ConfirmationToken, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || !b.now().Before(time.Unix(expires, 0)) {
+		return false
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signature, b.mac(ctx, req, ids, parts[0]))
+}
+
+// mac signs the caller and tenant of ctx, the action of req, the todos ids and the expiry
+func (b *BulkHandler) mac(ctx context.Context, req models.BulkRequest, ids []uuid.UUID, expires string) []byte {
+	sorted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		sorted = append(sorted, id.String())
+	}
+	sort.Strings(sorted)
+
+	var dueDate string
+	if req.DueDate != nil {
+		dueDate = req.DueDate.UTC().Format(time.RFC3339Nano)
+	}
+	h := hmac.New(sha256.New, b.key)
+	for _, field := range []string{userID(ctx), tenant.FromContext(ctx), req.Action, dueDate, req.Tag, expires, strings.Join(sorted, ",")} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
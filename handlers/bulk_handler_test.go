@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkHandler_HandleBulk(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryTodoRepository()
+	for _, name := range []string{"groceries", "garden", "grocery run", "taxes"} {
+		todo := newTodo()
+		todo.Name = name
+		repo.AddTodo(ctx, todo)
+	}
+	h, err := NewBulkHandler(repo)
+	assert.Nil(t, err)
+
+	do := func(query, payload string) (int, models.BulkResponse) {
+		request, _ := http.NewRequest("POST", "/v1/todo/bulk?"+query, strings.NewReader(payload))
+		responseRecorder := httptest.NewRecorder()
+		h.HandleBulk(responseRecorder, request)
+		var response models.BulkResponse
+		json.NewDecoder(responseRecorder.Body).Decode(&response)
+		return responseRecorder.Code, response
+	}
+	names := func() []string {
+		var names []string
+		todoList, _ := repo.GetTodo(ctx)
+		for _, todo := range todoList {
+			names = append(names, todo.Name)
+		}
+		return names
+	}
+
+	// a dry run lists the selected todos without applying the action
+	code, response := do("search=GROC", `{"action":"complete","dryRun":true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(response.IDs))
+	assert.Empty(t, response.ConfirmationToken)
+	assert.Empty(t, response.Results)
+	stored, _ := repo.GetTodoByID(ctx, response.IDs[0])
+	assert.False(t, stored.Completed)
+
+	code, response = do("search=groc&skip=1", `{"action":"complete"}`)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Equal(t, 1, len(response.Results)) {
+		assert.Equal(t, http.StatusNoContent, response.Results[0].Status)
+	}
+	stored, _ = repo.GetTodoByID(ctx, response.IDs[0])
+	assert.True(t, stored.Completed)
+	assert.Equal(t, "grocery run", stored.Name)
+
+	// overwriting due dates needs the token of a dry run
+	code, _ = do("search=g&limit=2", `{"action":"setDueDate","dueDate":"2030-01-02T00:00:00Z"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, code)
+	_, response = do("search=g&limit=2", `{"action":"setDueDate","dueDate":"2030-01-02T00:00:00Z","dryRun":true}`)
+	assert.NotEmpty(t, response.ConfirmationToken)
+	code, response = do("search=g&limit=2", `{"action":"setDueDate","dueDate":"2030-01-02T00:00:00Z","confirmationToken":"`+response.ConfirmationToken+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(response.IDs))
+	stored, _ = repo.GetTodoByID(ctx, response.IDs[1])
+	assert.Equal(t, time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), stored.DueDate.UTC())
+
+	code, response = do("search=groc", `{"action":"addTag","tag":" errands "}`)
+	assert.Equal(t, http.StatusOK, code)
+	do("search=groc", `{"action":"addTag","tag":"errands"}`)
+	stored, _ = repo.GetTodoByID(ctx, response.IDs[0])
+	assert.Equal(t, []string{"errands"}, stored.Tags)
+
+	code, response = do("search=taxes", `{"action":"archive"}`)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Equal(t, 1, len(response.Results)) {
+		assert.Equal(t, http.StatusNoContent, response.Results[0].Status)
+	}
+	stored, _ = repo.GetTodoByID(ctx, response.IDs[0])
+	assert.True(t, stored.Archived)
+
+	// a destructive action needs the token of a dry run selecting the same todos
+	code, _ = do("search=g", `{"action":"delete"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, code)
+	code, response = do("search=g", `{"action":"delete","dryRun":true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, response.ConfirmationToken)
+	assert.NotNil(t, response.ExpiresAt)
+	token := response.ConfirmationToken
+
+	code, _ = do("search=gro", `{"action":"delete","confirmationToken":"`+token+`"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = do("search=g", `{"action":"delete","confirmationToken":"1.00"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, 4, len(names()))
+
+	code, response = do("search=g", `{"action":"delete","confirmationToken":"`+token+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, len(response.Results))
+	assert.Equal(t, []string{"taxes"}, names())
+
+	// the token expires
+	_, response = do("", `{"action":"delete","dryRun":true}`)
+	token = response.ConfirmationToken
+	h.now = func() time.Time { return time.Now().Add(confirmationTTL + time.Second) }
+	code, _ = do("", `{"action":"delete","confirmationToken":"`+token+`"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	// so does an action selecting the todos without a search
+	code, _ = do("limit=1", `{"action":"reopen"}`)
+	assert.Equal(t, http.StatusPreconditionRequired, code)
+	_, response = do("limit=1", `{"action":"reopen","dryRun":true}`)
+	assert.NotEmpty(t, response.ConfirmationToken)
+	code, response = do("limit=1", `{"action":"reopen","confirmationToken":"`+response.ConfirmationToken+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(response.Results))
+
+	code, _ = do("", `{"action":"addTag","tag":" "}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("", `{"action":"unarchive"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("skip=x", `{"action":"complete"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestBulkHandler_HandleBulk_SelectsTheList(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryTodoRepository()
+	for _, name := range []string{"groceries", "garden", "grocery run", "taxes"} {
+		todo := newTodo()
+		todo.Name = name
+		repo.AddTodo(ctx, todo)
+	}
+	h, err := NewBulkHandler(repo)
+	assert.Nil(t, err)
+	todoHandle := NewTodoHandler(repo)
+
+	// a dry run selects the todos GET /v1/todo lists, skip included
+	for _, query := range []string{"search=g", "search=g&skip=1", "search=g&skip=5", "search=g&skip=-1&limit=2", "skip=3&limit=1", "limit=0"} {
+		request, _ := http.NewRequest("GET", "/v1/todo?"+query, nil)
+		responseRecorder := httptest.NewRecorder()
+		todoHandle.HandleGetTodoList(responseRecorder, request)
+		var todoList []models.Todo
+		json.NewDecoder(responseRecorder.Body).Decode(&todoList)
+		var listed []uuid.UUID
+		for _, todo := range todoList {
+			listed = append(listed, todo.ID)
+		}
+
+		request, _ = http.NewRequest("POST", "/v1/todo/bulk?"+query, strings.NewReader(`{"action":"complete","dryRun":true}`))
+		responseRecorder = httptest.NewRecorder()
+		h.HandleBulk(responseRecorder, request)
+		var response models.BulkResponse
+		json.NewDecoder(responseRecorder.Body).Decode(&response)
+		assert.Equal(t, listed, response.IDs, query)
+	}
+}
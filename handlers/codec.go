@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// tracer starts the spans of the handlers, children of the span of the router
+var tracer = otel.Tracer("github.com/elumbantoruan/todo/handlers")
+
+// decode decodes the JSON request payload from r into v, in its own span.
+// Unknown fields and data after the payload are rejected, and v is validated
+// when it has a Validate method
+func decode(ctx context.Context, r io.Reader, v interface{}) error {
+	_, span := tracer.Start(ctx, "decode")
+	defer span.End()
+
+	err := decodeStrict(r, v)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func decodeStrict(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	var extra json.RawMessage
+	if dec.Decode(&extra) != io.EOF {
+		return errors.New("unexpected data after the JSON payload")
+	}
+	if validator, ok := v.(interface{ Validate() error }); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// decodeStatus returns the status of a request whose payload failed to decode with err,
+// 413 when it is larger than allowed
+func decodeStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeDecodeError responds to a request whose payload failed to decode with err,
+// listing the fields in error
+func writeDecodeError(ctx context.Context, w http.ResponseWriter, err error) {
+	status := decodeStatus(err)
+	if status != http.StatusBadRequest {
+		w.WriteHeader(status)
+		return
+	}
+	var (
+		invalid   *models.ValidationError
+		typeError *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(ctx, w, status, invalid)
+	case errors.As(err, &typeError):
+		writeJSON(ctx, w, status, &models.ValidationError{Errors: []models.FieldError{
+			{Field: typeError.Field, Message: "cannot be a JSON " + typeError.Value},
+		}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		writeJSON(ctx, w, status, &models.ValidationError{Errors: []models.FieldError{
+			{Field: field, Message: "is unknown"},
+		}})
+	default:
+		writeJSON(ctx, w, status, &models.ValidationError{Errors: []models.FieldError{
+			{Message: err.Error()},
+		}})
+	}
+}
+
+// encode encodes v as the JSON response payload to w, in its own span
+func encode(ctx context.Context, w io.Writer, v interface{}) error {
+	_, span := tracer.Start(ctx, "encode")
+	defer span.End()
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/pkg/errors"
+)
+
+// Check reports whether a dependency of the server is ready
+type Check func(ctx context.Context) error
+
+// BuildInfo describes the running build
+type BuildInfo struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	GoVersion      string `json:"goVersion"`
+	StorageBackend string `json:"storageBackend"`
+	SchemaVersion  int    `json:"schemaVersion"`
+}
+
+// HealthHandler handles health, readiness and version probes
+type HealthHandler struct {
+	info    BuildInfo
+	names   []string
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// healthStatus is the payload of /healthz and /readyz
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// NewHealthHandler creates an instance of HealthHandler
+func NewHealthHandler(info BuildInfo) *HealthHandler {
+	return &HealthHandler{
+		info:    info,
+		checks:  make(map[string]Check),
+		timeout: 2 * time.Second,
+	}
+}
+
+// AddCheck adds a readiness check reported under name by /readyz
+func (h *HealthHandler) AddCheck(name string, check Check) {
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// HandleHealthz handles http GET action telling the process is alive
+func (h *HealthHandler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// HandleReadyz handles http GET action running every readiness check,
+// it returns 503 when one of them fails
+func (h *HealthHandler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	status := healthStatus{
+		Status: "ok",
+		Checks: make(map[string]string, len(h.names)),
+	}
+	code := http.StatusOK
+	for _, name := range h.names {
+		err := h.checks[name](ctx)
+		if err != nil {
+			status.Status = "unavailable"
+			status.Checks[name] = err.Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		status.Checks[name] = "ok"
+	}
+	writeJSON(r.Context(), w, code, status)
+}
+
+// HandleVersion handles http GET action describing the running build
+func (h *HealthHandler) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, http.StatusOK, h.info)
+}
+
+// RepositoryCheck checks that repo can be listed
+// The check carries no tenant, so with tenancy it only covers the default tenant
+func RepositoryCheck(repo repositories.TodoRepositoryV2) Check {
+	return func(ctx context.Context) error {
+		it, err := repo.IterateTodo(ctx)
+		if err != nil {
+			return err
+		}
+		return it.Close()
+	}
+}
+
+// WritableDirCheck checks that a file can be created in dir.
+// The probe is a dot-file, which the file storage does not read as a record
+func WritableDirCheck(dir string) Check {
+	return func(ctx context.Context) error {
+		f, err := ioutil.TempFile(dir, ".readyz")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		f.Close()
+		return errors.WithStack(os.Remove(f.Name()))
+	}
+}
+
+// writeJSON writes v as the JSON response payload with status code
+func writeJSON(ctx context.Context, w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	encode(ctx, w, v)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler_HandleReadyz(t *testing.T) {
+	h := NewHealthHandler(BuildInfo{})
+	h.AddCheck("repository", func(ctx context.Context) error { return nil })
+	h.AddCheck("dataDir", func(ctx context.Context) error { return errors.New("read-only file system") })
+
+	request, _ := http.NewRequest("GET", "/readyz", nil)
+	responseRecorder := httptest.NewRecorder()
+	h.HandleReadyz(responseRecorder, request)
+
+	assert.Equal(t, http.StatusServiceUnavailable, responseRecorder.Code)
+
+	var status healthStatus
+	json.NewDecoder(responseRecorder.Body).Decode(&status)
+	assert.Equal(t, "unavailable", status.Status)
+	assert.Equal(t, "ok", status.Checks["repository"])
+	assert.Equal(t, "read-only file system", status.Checks["dataDir"])
+}
+
+func TestRepositoryCheck_Tenancy(t *testing.T) {
+	// the storage of acme is broken, the check only covers the default tenant
+	repo := repositories.NewTenantTodoRepository("default", func(tenantID string) (repositories.TodoRepositoryV2, error) {
+		if tenantID != "default" {
+			return nil, errors.New("broken storage")
+		}
+		return repositories.NewMemoryTodoRepository(), nil
+	})
+	_, err := repo.GetTodo(tenant.NewContext(context.Background(), "acme"))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, RepositoryCheck(repo)(context.Background()))
+	assert.Equal(t, []string{"default"}, repo.Tenants())
+}
+
+func TestWritableDirCheck(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	// the probe is removed once the check is done
+	assert.Nil(t, WritableDirCheck(dir)(ctx))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+
+	assert.NotNil(t, WritableDirCheck(filepath.Join(dir, "missing"))(ctx))
+}
+
+func TestHealthHandler_HandleVersion(t *testing.T) {
+	info := BuildInfo{
+		Version:        "1.0.0",
+		Commit:         "abc",
+		GoVersion:      "go1.x",
+		StorageBackend: "file",
+		SchemaVersion:  1,
+	}
+	h := NewHealthHandler(info)
+
+	request, _ := http.NewRequest("GET", "/version", nil)
+	responseRecorder := httptest.NewRecorder()
+	h.HandleVersion(responseRecorder, request)
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+
+	var val BuildInfo
+	json.NewDecoder(responseRecorder.Body).Decode(&val)
+	assert.Equal(t, info, val)
+}
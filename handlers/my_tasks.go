@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/elumbantoruan/todo/models"
+)
+
+// HandleGetMyTasks handles http GET action listing the open tasks assigned to the caller
+// across every todo the caller can read. sort=dueDate orders them by the due date of
+// their todo, sort=-dueDate in reverse; tasks of todos without due date come last
+func (t *TodoHandler) HandleGetMyTasks(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleGetMyTasks")
+	defer span.End()
+
+	me := userID(ctx)
+	if me == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	order := r.URL.Query().Get("sort")
+	if order != "" && order != "dueDate" && order != "-dueDate" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	it, err := t.repo.IterateTodo(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer it.Close()
+	tasks := []models.AssignedTask{}
+	for it.Next() {
+		todo := it.Todo()
+		for _, task := range todo.Tasks {
+			if task.AssigneeID == me && !task.Completed {
+				tasks = append(tasks, models.AssignedTask{
+					Task:     task,
+					TodoID:   todo.ID,
+					TodoName: todo.Name,
+					DueDate:  todo.DueDate,
+				})
+			}
+		}
+	}
+	if it.Err() != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if order != "" {
+		descending := order == "-dueDate"
+		sort.SliceStable(tasks, func(i, j int) bool {
+			a, b := tasks[i].DueDate, tasks[j].DueDate
+			if a == nil || b == nil {
+				return a != nil
+			}
+			if descending {
+				return a.After(*b)
+			}
+			return a.Before(*b)
+		})
+	}
+	writeJSON(ctx, w, http.StatusOK, tasks)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTodoHandler_HandleGetMyTasks(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryTodoRepository()
+	soon := time.Now().Add(time.Hour)
+	later := time.Now().Add(48 * time.Hour)
+	repo.AddTodo(ctx, models.Todo{ID: uuid.New(), Name: "later", DueDate: &later, Tasks: []models.Task{
+		{ID: uuid.New(), Name: "mine", AssigneeID: "alice"},
+		{ID: uuid.New(), Name: "done", AssigneeID: "alice", Completed: true},
+		{ID: uuid.New(), Name: "theirs", AssigneeID: "bob"},
+	}})
+	repo.AddTodo(ctx, models.Todo{ID: uuid.New(), Name: "someday", Tasks: []models.Task{
+		{ID: uuid.New(), Name: "mine too", AssigneeID: "alice"},
+	}})
+	repo.AddTodo(ctx, models.Todo{ID: uuid.New(), Name: "soon", DueDate: &soon, Tasks: []models.Task{
+		{ID: uuid.New(), Name: "urgent", AssigneeID: "alice"},
+	}})
+	handle := NewTodoHandler(repo)
+
+	rr := httptest.NewRecorder()
+	handle.HandleGetMyTasks(rr, httptest.NewRequest("GET", "/v1/me/tasks", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	get := func(query string) (int, []string) {
+		req := httptest.NewRequest("GET", "/v1/me/tasks"+query, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{UserID: "alice"}))
+		rr := httptest.NewRecorder()
+		handle.HandleGetMyTasks(rr, req)
+		var tasks []models.AssignedTask
+		json.NewDecoder(rr.Body).Decode(&tasks)
+		var names []string
+		for _, task := range tasks {
+			names = append(names, task.TodoName+"/"+task.Name)
+		}
+		return rr.Code, names
+	}
+
+	code, names := get("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"later/mine", "someday/mine too", "soon/urgent"}, names)
+	_, names = get("?sort=dueDate")
+	assert.Equal(t, []string{"soon/urgent", "later/mine", "someday/mine too"}, names)
+	_, names = get("?sort=-dueDate")
+	assert.Equal(t, []string{"later/mine", "soon/urgent", "someday/mine too"}, names)
+	code, _ = get("?sort=name")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
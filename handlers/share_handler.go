@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+)
+
+// ShareHandler handles the collaborators of a todo
+type ShareHandler struct {
+	repo  repositories.TodoRepositoryV2
+	users *auth.UserStore
+}
+
+// NewShareHandler creates an instance of ShareHandler
+func NewShareHandler(repo repositories.TodoRepositoryV2, users *auth.UserStore) *ShareHandler {
+	return &ShareHandler{
+		repo:  repo,
+		users: users,
+	}
+}
+
+// shareRequest is the payload of an invitation
+type shareRequest struct {
+	Role string `json:"role"`
+}
+
+// Validate returns a ValidationError unless the role is one of the roles
+func (s *shareRequest) Validate() error {
+	if !models.ValidRole(s.Role) {
+		return &models.ValidationError{Errors: []models.FieldError{
+			{Field: "role", Message: "must be one of " + models.RoleViewer + ", " + models.RoleEditor + ", " + models.RoleOwner},
+		}}
+	}
+	return nil
+}
+
+// HandleShare handles http PUT action to invite a user on a todo with a role,
+// or to change the role of a collaborator
+func (s *ShareHandler) HandleShare(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "ShareHandler.HandleShare")
+	defer span.End()
+	defer r.Body.Close()
+
+	id, u, ok := s.target(w, r)
+	if !ok {
+		return
+	}
+	var req shareRequest
+	err := decode(ctx, r.Body, &req)
+	if err != nil {
+		writeDecodeError(ctx, w, err)
+		return
+	}
+	err = s.repo.ShareTodo(ctx, id, models.Collaborator{UserID: u.ID, Name: u.Name, Role: req.Role})
+	if err != nil {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
+			w.WriteHeader(http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "cannot be shared with its owner") {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUnshare handles http DELETE action to revoke the access of a collaborator,
+// collaborators revoke their own access to leave a todo
+func (s *ShareHandler) HandleUnshare(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "ShareHandler.HandleUnshare")
+	defer span.End()
+
+	id, u, ok := s.target(w, r)
+	if !ok {
+		return
+	}
+	err := s.repo.UnshareTodo(ctx, id, u.ID)
+	if err != nil {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// target returns the todo id and the user of the path, or responds with an error
+func (s *ShareHandler) target(w http.ResponseWriter, r *http.Request) (uuid.UUID, auth.User, bool) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return uuid.Nil, auth.User{}, false
+	}
+	u, err := s.users.GetByName(vars["username"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return uuid.Nil, auth.User{}, false
+	}
+	return id, u, true
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareHandler(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "share")
+	defer os.RemoveAll(dir)
+	users, _ := auth.LoadUserStore(filepath.Join(dir, "users.json"))
+	alice, _ := users.Create("alice", "correct horse", []string{auth.ScopeTodoWrite})
+	bob, _ := users.Create("bob", "battery staple", []string{auth.ScopeTodoWrite})
+
+	repo := repositories.Chain(repositories.NewMemoryTodoRepository(), repositories.ACL())
+	todo := models.Todo{ID: uuid.New(), Name: "groceries", OwnerID: alice.ID, Tasks: []models.Task{{ID: uuid.New(), Name: "milk"}}}
+	repo.AddTodo(context.Background(), todo)
+
+	m := mux.NewRouter()
+	handle := NewTodoHandler(repo)
+	shareHandle := NewShareHandler(repo, users)
+	m.HandleFunc("/v1/todo/{id}", handle.HandleGetTodoByID).Methods("GET")
+	m.HandleFunc("/v1/todo/{id}", handle.HandleUpdateTodo).Methods("PUT")
+	m.HandleFunc("/v1/todo/{id}/task/{taskID}/complete", handle.HandleUpdateTask).Methods("PUT")
+	m.HandleFunc("/v1/todo/{id}/collaborators/{username}", shareHandle.HandleShare).Methods("PUT")
+	m.HandleFunc("/v1/todo/{id}/collaborators/{username}", shareHandle.HandleUnshare).Methods("DELETE")
+
+	do := func(u auth.User, method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{User: u.Name, UserID: u.ID, Scopes: u.Scopes}))
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	todoPath := "/v1/todo/" + todo.ID.String()
+	taskPath := todoPath + "/task/" + todo.Tasks[0].ID.String() + "/complete"
+
+	assert.Equal(t, http.StatusNotFound, do(bob, "GET", todoPath, ""))
+	assert.Equal(t, http.StatusNotFound, do(bob, "PUT", todoPath+"/collaborators/bob", `{"role":"viewer"}`))
+	assert.Equal(t, http.StatusNotFound, do(alice, "PUT", todoPath+"/collaborators/carol", `{"role":"viewer"}`))
+	assert.Equal(t, http.StatusBadRequest, do(alice, "PUT", todoPath+"/collaborators/bob", `{"role":"admin"}`))
+	assert.Equal(t, http.StatusBadRequest, do(alice, "PUT", todoPath+"/collaborators/alice", `{"role":"viewer"}`))
+	assert.Equal(t, http.StatusNoContent, do(alice, "PUT", todoPath+"/collaborators/bob", `{"role":"viewer"}`))
+
+	// a viewer reads the todo, but cannot update it nor complete its tasks
+	assert.Equal(t, http.StatusAccepted, do(bob, "GET", todoPath, ""))
+	assert.Equal(t, http.StatusForbidden, do(bob, "PUT", todoPath, `{"completed":true}`))
+	assert.Equal(t, http.StatusForbidden, do(bob, "PUT", taskPath, `{"completed":true}`))
+
+	assert.Equal(t, http.StatusNoContent, do(alice, "PUT", todoPath+"/collaborators/bob", `{"role":"editor"}`))
+	assert.Equal(t, http.StatusOK, do(bob, "PUT", taskPath, `{"completed":true}`))
+	assert.Equal(t, http.StatusForbidden, do(bob, "PUT", todoPath+"/collaborators/alice", `{"role":"viewer"}`))
+
+	assert.Equal(t, http.StatusNoContent, do(alice, "DELETE", todoPath+"/collaborators/bob", ""))
+	assert.Equal(t, http.StatusNotFound, do(bob, "GET", todoPath, ""))
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/elumbantoruan/todo/models"
+)
+
+// todoFilter selects todos by the search, skip and limit parameters of GET /v1/todo
+type todoFilter struct {
+	// search is matched against the names of the todos, lowercased
+	search string
+	// skip is the number of matching todos skipped
+	skip int
+	// limit is the number of todos selected, 0 does not limit them
+	limit int
+}
+
+// parseTodoFilter reads a todoFilter from the query of a request
+func parseTodoFilter(query url.Values) (todoFilter, error) {
+	var (
+		f   todoFilter
+		err error
+	)
+	f.search = strings.ToLower(query.Get("search"))
+	if _, ok := query["skip"]; ok {
+		f.skip, err = strconv.Atoi(query["skip"][0])
+		if err != nil {
+			return f, err
+		}
+	}
+	if _, ok := query["limit"]; ok {
+		f.limit, err = strconv.Atoi(query["limit"][0])
+		if err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// selectsAll reports whether f selects the todos without a search,
+// only skipping or limiting the list of every todo
+func (f todoFilter) selectsAll() bool {
+	return len(f.search) == 0
+}
+
+// apply returns the todos of todoList matching f, after skip and up to limit.
+// skip is ignored when it would skip every matching todo
+func (f todoFilter) apply(todoList []models.Todo) []models.Todo {
+	var filteredTodoList []models.Todo
+	for _, todo := range todoList {
+		if f.matches(todo) {
+			filteredTodoList = append(filteredTodoList, todo)
+		}
+	}
+	if f.skip > 0 && len(filteredTodoList) > f.skip {
+		filteredTodoList = filteredTodoList[f.skip:]
+	}
+	if f.limit > 0 && len(filteredTodoList) > f.limit {
+		filteredTodoList = filteredTodoList[:f.limit]
+	}
+	return filteredTodoList
+}
+
+// matches reports whether the name of todo contains the search
+func (f todoFilter) matches(todo models.Todo) bool {
+	return len(f.search) == 0 || strings.Contains(strings.ToLower(todo.Name), f.search)
+}
@@ -1,14 +1,18 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/metrics"
 	"github.com/elumbantoruan/todo/models"
 
 	"github.com/elumbantoruan/todo/repositories"
@@ -16,50 +20,55 @@ import (
 
 // TodoHandler handles Todo API operations
 type TodoHandler struct {
-	repo repositories.TodoRepository
+	repo repositories.TodoRepositoryV2
 }
 
 // NewTodoHandler creates an instance of TodoHandler
-func NewTodoHandler(repo repositories.TodoRepository) *TodoHandler {
+func NewTodoHandler(repo repositories.TodoRepositoryV2) *TodoHandler {
 	return &TodoHandler{
 		repo: repo,
 	}
 }
 
-// HandleAddTodo handles http POST action to add todo
+// HandleAddTodo handles http POST action to add todo, and returns the todo with its Location
 func (t *TodoHandler) HandleAddTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleAddTodo")
+	defer span.End()
 	defer r.Body.Close()
 
 	var todo models.Todo
-	err := json.NewDecoder(r.Body).Decode(&todo)
+	err := decode(ctx, r.Body, &todo)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeDecodeError(ctx, w, err)
 		return
 	}
 
-	// if empty guid
-	if todo.ID == uuid.Nil {
-		todo.ID = uuid.New()
-	}
-	for i := 0; i < len(todo.Tasks); i++ {
-		if todo.Tasks[i].ID == uuid.Nil {
-			todo.Tasks[i].ID = uuid.New()
-		}
-	}
-	err = t.repo.AddTodo(todo)
+	prepareTodo(ctx, &todo)
+	err = t.repo.AddTodo(ctx, todo)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate todoID") {
 			w.WriteHeader(http.StatusConflict)
+		} else if isTooManyTasks(err) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else if isQuotaExceeded(err) {
+			w.WriteHeader(http.StatusInsufficientStorage)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	// the todo is returned as stored, the payload is returned if it cannot be read back
+	if stored, err := t.repo.GetTodoByID(ctx, todo.ID); err == nil {
+		todo = *stored
+	}
+	w.Header().Set("Location", todoLocation(todo.ID))
+	writeJSON(ctx, w, http.StatusCreated, todo)
 }
 
-// HandleAddTask handles http POST action to add task
+// HandleAddTask handles http POST action to add task, and returns the task with its Location
 func (t *TodoHandler) HandleAddTask(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleAddTask")
+	defer span.End()
 	defer r.Body.Close()
 
 	vars := mux.Vars(r)
@@ -73,28 +82,43 @@ func (t *TodoHandler) HandleAddTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var task models.Task
-	err = json.NewDecoder(r.Body).Decode(&task)
+	err = decode(ctx, r.Body, &task)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // 400
+		writeDecodeError(ctx, w, err)
 		return
 	}
-	if task.ID == uuid.Nil {
-		task.ID = uuid.New()
-	}
-	err = t.repo.AddTask(id, task)
+	prepareTask(ctx, &task)
+	err = t.repo.AddTask(ctx, id, task)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate taskId") {
 			w.WriteHeader(http.StatusConflict) // 409
+		} else if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden) // 403
+		} else if strings.Contains(err.Error(), "no such file") {
+			w.WriteHeader(http.StatusNotFound) // 404
+		} else if isTooManyTasks(err) {
+			w.WriteHeader(http.StatusUnprocessableEntity) // 422
+		} else if isQuotaExceeded(err) {
+			w.WriteHeader(http.StatusInsufficientStorage) // 507
 		} else {
 			w.WriteHeader(http.StatusInternalServerError) // 500
 		}
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	// the task is returned as stored, the payload is returned if it cannot be read back
+	if todo, err := t.repo.GetTodoByID(ctx, id); err == nil {
+		if stored := findTask(todo, task.ID); stored != nil {
+			task = *stored
+		}
+	}
+	w.Header().Set("Location", taskLocation(id, task.ID))
+	writeJSON(ctx, w, http.StatusCreated, task)
 }
 
-// HandleUpdateTask handles http PUT action
+// HandleUpdateTask handles http PUT action, and returns the updated task
 func (t *TodoHandler) HandleUpdateTask(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleUpdateTask")
+	defer span.End()
 	defer r.Body.Close()
 
 	vars := mux.Vars(r)
@@ -107,95 +131,133 @@ func (t *TodoHandler) HandleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if _, ok := vars["taskId"]; !ok {
+	if _, ok := vars["taskID"]; !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	taskID, err := uuid.Parse(vars["taskId"])
+	taskID, err := uuid.Parse(vars["taskID"])
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	var tc models.CompletedTask
-	err = json.NewDecoder(r.Body).Decode(&tc)
+	err = decode(ctx, r.Body, &tc)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeDecodeError(ctx, w, err)
 		return
 	}
-	err = t.repo.UpdateTask(id, taskID, tc.Completed)
+	// the task is read first, so an unknown task is not updated
+	// and only the tasks it completes are counted
+	before, err := t.repo.GetTodoByID(ctx, id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	previous := findTask(before, taskID)
+	if previous == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	wasCompleted := previous.Completed
+	err = t.repo.UpdateTask(ctx, id, taskID, tc.Completed, userID(ctx))
+	if err != nil {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	todo, err := t.repo.GetTodoByID(ctx, id)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	task := findTask(todo, taskID)
+	if task == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if task.Completed && !wasCompleted {
+		metrics.TasksCompleted.Inc()
+	}
+	writeJSON(ctx, w, http.StatusOK, task)
 }
 
-// HandleGetTodoList handles http GET action
-func (t *TodoHandler) HandleGetTodoList(w http.ResponseWriter, r *http.Request) {
+// HandleGetTask handles http GET action for specific TaskID
+func (t *TodoHandler) HandleGetTask(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleGetTask")
+	defer span.End()
 
-	var (
-		todoList         []models.Todo
-		filteredTodoList []models.Todo
-		search           string
-		skip             int
-		limit            int
-		err              error
-	)
-	todoList, err = t.repo.GetTodo()
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if len(todoList) == 0 {
-		w.WriteHeader(http.StatusNotFound)
+	taskID, err := uuid.Parse(vars["taskID"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-
-	vars := r.URL.Query()
-	if _, ok := vars["search"]; ok {
-		search = vars["search"][0]
+	todo, err := t.repo.GetTodoByID(ctx, id)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		return
 	}
-	if _, ok := vars["skip"]; ok {
-		skip, err = strconv.Atoi(vars["skip"][0])
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	task := findTask(todo, taskID)
+	if task == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
-	if _, ok := vars["limit"]; ok {
-		limit, err = strconv.Atoi(vars["limit"][0])
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	writeJSON(ctx, w, http.StatusOK, task)
+}
+
+// HandleGetTodoList handles http GET action
+// The list is streamed in constant memory as NDJSON when the client accepts
+// application/x-ndjson, or as a JSON array when stream=true
+func (t *TodoHandler) HandleGetTodoList(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleGetTodoList")
+	defer span.End()
+
+	if format := streamFormat(r); format != "" {
+		t.streamTodoList(w, r.WithContext(ctx), format)
+		return
 	}
 
-	if len(search) > 0 {
-		for _, t := range todoList {
-			if strings.Contains(strings.ToLower(t.Name), strings.ToLower(search)) {
-				filteredTodoList = append(filteredTodoList, t)
-			}
-		}
-	} else {
-		filteredTodoList = todoList
+	todoList, err := t.repo.GetTodo(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
-	if skip > 0 {
-		if len(filteredTodoList) > skip {
-			filteredTodoList = filteredTodoList[skip:]
+	// corrupt records are skipped by the repository, let the client know the list is partial
+	if reporter, ok := t.repo.(repositories.CorruptRecordReporter); ok {
+		if corrupt := reporter.CorruptRecords(ctx); len(corrupt) > 0 {
+			w.Header().Set("X-Corrupt-Records", strconv.Itoa(len(corrupt)))
 		}
 	}
-	if limit > 0 {
-		if len(filteredTodoList) > limit {
-			filteredTodoList = filteredTodoList[:limit]
-		}
+	if len(todoList) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(filteredTodoList)
+	encode(ctx, w, filter.apply(todoList))
 }
 
 // HandleGetTodoByID handles http GET action for specific ToDoID
 func (t *TodoHandler) HandleGetTodoByID(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleGetTodoByID")
+	defer span.End()
+
 	vars := mux.Vars(r)
 	if _, ok := vars["id"]; !ok {
 		w.WriteHeader(http.StatusNotFound)
@@ -206,9 +268,11 @@ func (t *TodoHandler) HandleGetTodoByID(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	todo, err := t.repo.GetTodoByID(id)
+	todo, err := t.repo.GetTodoByID(ctx, id)
 	if err != nil {
-		if strings.Contains(err.Error(), "no such file") {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
 			w.WriteHeader(http.StatusNotFound)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -217,11 +281,14 @@ func (t *TodoHandler) HandleGetTodoByID(w http.ResponseWriter, r *http.Request)
 	}
 	w.WriteHeader(http.StatusAccepted)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(todo)
+	encode(ctx, w, todo)
 }
 
 // HandleDeleteTask handles http DELETE action for specific TaskID
 func (t *TodoHandler) HandleDeleteTask(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleDeleteTask")
+	defer span.End()
+
 	vars := mux.Vars(r)
 	if _, ok := vars["id"]; !ok {
 		w.WriteHeader(http.StatusNotFound)
@@ -232,18 +299,20 @@ func (t *TodoHandler) HandleDeleteTask(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if _, ok := vars["taskId"]; !ok {
+	if _, ok := vars["taskID"]; !ok {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	taskID, err := uuid.Parse(vars["taskId"])
+	taskID, err := uuid.Parse(vars["taskID"])
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	err = t.repo.DeleteTask(id, taskID)
+	err = t.repo.DeleteTask(ctx, id, taskID)
 	if err != nil {
-		if strings.Contains(err.Error(), "no such file") {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
 			w.WriteHeader(http.StatusNotFound)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -255,6 +324,8 @@ func (t *TodoHandler) HandleDeleteTask(w http.ResponseWriter, r *http.Request) {
 
 // HandleUpdateTodo handles http PUT action for specific ToDoID
 func (t *TodoHandler) HandleUpdateTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleUpdateTodo")
+	defer span.End()
 	defer r.Body.Close()
 
 	vars := mux.Vars(r)
@@ -268,14 +339,16 @@ func (t *TodoHandler) HandleUpdateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var ut models.UpdatedTodo
-	err = json.NewDecoder(r.Body).Decode(&ut)
+	err = decode(ctx, r.Body, &ut)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeDecodeError(ctx, w, err)
 		return
 	}
-	err = t.repo.UpdateTodo(id, ut.Completed, ut.DueDate)
+	err = t.repo.UpdateTodo(ctx, id, ut.Completed, ut.DueDate)
 	if err != nil {
-		if strings.Contains(err.Error(), "no such file") {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
 			w.WriteHeader(http.StatusNotFound)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -287,6 +360,9 @@ func (t *TodoHandler) HandleUpdateTodo(w http.ResponseWriter, r *http.Request) {
 
 // HandleDeleteTodo handles http DELETE action for specific ToDoID
 func (t *TodoHandler) HandleDeleteTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "TodoHandler.HandleDeleteTodo")
+	defer span.End()
+
 	vars := mux.Vars(r)
 	if _, ok := vars["id"]; !ok {
 		w.WriteHeader(http.StatusNotFound)
@@ -297,9 +373,11 @@ func (t *TodoHandler) HandleDeleteTodo(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	err = t.repo.DeleteTodo(id)
+	err = t.repo.DeleteTodo(ctx, id)
 	if err != nil {
-		if strings.Contains(err.Error(), "no such file") {
+		if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "no such file") {
 			w.WriteHeader(http.StatusNotFound)
 		} else {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -308,3 +386,76 @@ func (t *TodoHandler) HandleDeleteTodo(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// userID returns the id of the authenticated caller of ctx, or an empty string
+func userID(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.UserID
+	}
+	return ""
+}
+
+// prepareTodo prepares the payload of a new todo: the missing ids are generated,
+// and the todo is owned by the caller and shared with nobody whatever the payload says
+func prepareTodo(ctx context.Context, todo *models.Todo) {
+	if todo.ID == uuid.Nil {
+		todo.ID = uuid.New()
+	}
+	todo.OwnerID = userID(ctx)
+	// collaborators are only invited through HandleShare, which checks their role
+	todo.Collaborators = nil
+	for i := 0; i < len(todo.Tasks); i++ {
+		prepareTask(ctx, &todo.Tasks[i])
+	}
+}
+
+// prepareTask prepares the payload of a new task: its id is generated when missing
+func prepareTask(ctx context.Context, task *models.Task) {
+	if task.ID == uuid.Nil {
+		task.ID = uuid.New()
+	}
+	recordCompletion(ctx, task)
+}
+
+// recordCompletion records the caller and now as the completion of a task
+// of the payload, whatever the payload says
+func recordCompletion(ctx context.Context, task *models.Task) {
+	completed := task.Completed
+	task.Completed = false
+	task.SetCompleted(completed, userID(ctx), time.Now().UTC())
+}
+
+// todoLocation returns the path of the todo todoID
+func todoLocation(todoID uuid.UUID) string {
+	return "/v1/todo/" + todoID.String()
+}
+
+// taskLocation returns the path of the task taskID of the todo todoID
+func taskLocation(todoID, taskID uuid.UUID) string {
+	return todoLocation(todoID) + "/task/" + taskID.String()
+}
+
+// findTask returns the task taskID of todo, or nil
+func findTask(todo *models.Todo, taskID uuid.UUID) *models.Task {
+	for i := range todo.Tasks {
+		if todo.Tasks[i].ID == taskID {
+			return &todo.Tasks[i]
+		}
+	}
+	return nil
+}
+
+// isForbidden reports whether err denies the call to the role of the caller on the todo
+func isForbidden(err error) bool {
+	return errors.Cause(err) == repositories.ErrForbidden
+}
+
+// isTooManyTasks reports whether err rejects a write exceeding the tasks, or the tags, allowed in a todo
+func isTooManyTasks(err error) bool {
+	return errors.Cause(err) == repositories.ErrTooManyTasks || errors.Cause(err) == repositories.ErrTooManyTags
+}
+
+// isQuotaExceeded reports whether err rejects a write exceeding the quota of the tenant
+func isQuotaExceeded(err error) bool {
+	return errors.Cause(err) == repositories.ErrQuotaExceeded
+}
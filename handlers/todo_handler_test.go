@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,10 +9,12 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/elumbantoruan/todo/metrics"
 	"github.com/elumbantoruan/todo/models"
 	"github.com/elumbantoruan/todo/repositories"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,10 +28,35 @@ func TestTodoHandler_HandleAddTodo(t *testing.T) {
 	request, _ := http.NewRequest("POST", url, strings.NewReader(string(bytes)))
 	responseRecorder := httptest.NewRecorder()
 
-	h := NewTodoHandler(mockRepo)
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
 	h.HandleAddTodo(responseRecorder, request)
 
 	assert.Equal(t, http.StatusCreated, responseRecorder.Code)
+	var created models.Todo
+	json.NewDecoder(responseRecorder.Body).Decode(&created)
+	assert.NotEqual(t, uuid.Nil, created.ID)
+	assert.Equal(t, todo.Name, created.Name)
+	assert.Equal(t, "/v1/todo/"+created.ID.String(), responseRecorder.Header().Get("Location"))
+}
+
+func TestTodoHandler_HandleAddTodo_IgnoresCollaborators(t *testing.T) {
+	repo := repositories.NewMemoryTodoRepository()
+
+	payload := `{"name":"plan","collaborators":[{"userId":"mallory","role":"admin"}]}`
+	request, _ := http.NewRequest("POST", "/v1/todo", strings.NewReader(payload))
+	responseRecorder := httptest.NewRecorder()
+
+	h := NewTodoHandler(repo)
+	h.HandleAddTodo(responseRecorder, request)
+
+	assert.Equal(t, http.StatusCreated, responseRecorder.Code)
+	var created models.Todo
+	json.NewDecoder(responseRecorder.Body).Decode(&created)
+	assert.Empty(t, created.Collaborators)
+	stored, err := repo.GetTodoByID(context.Background(), created.ID)
+	if assert.Nil(t, err) {
+		assert.Empty(t, stored.Collaborators)
+	}
 }
 
 func TestTodoHandler_HandleAddTodo_Duplicate(t *testing.T) {
@@ -47,12 +75,53 @@ func TestTodoHandler_HandleAddTodo_Duplicate(t *testing.T) {
 	request, _ := http.NewRequest("POST", url, strings.NewReader(string(bytes)))
 	responseRecorder := httptest.NewRecorder()
 
-	h := NewTodoHandler(mockRepo)
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
 	h.HandleAddTodo(responseRecorder, request)
 
 	assert.Equal(t, http.StatusConflict, responseRecorder.Code)
 }
 
+func TestTodoHandler_HandleAddTodo_TooLarge(t *testing.T) {
+	mockRepo := repositories.MockTodoRepository{}
+	mockRepo.Clear()
+
+	url := "/v1/todo"
+	bytes, _ := json.Marshal(newTodo())
+	request, _ := http.NewRequest("POST", url, strings.NewReader(string(bytes)))
+	responseRecorder := httptest.NewRecorder()
+	request.Body = http.MaxBytesReader(responseRecorder, request.Body, 16)
+
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
+	h.HandleAddTodo(responseRecorder, request)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, responseRecorder.Code)
+}
+
+func TestTodoHandler_HandleAddTodo_Invalid(t *testing.T) {
+	mockRepo := repositories.MockTodoRepository{}
+	mockRepo.Clear()
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
+
+	for payload, fields := range map[string][]string{
+		`{"name":"","dueDate":"1970-01-01T00:00:00Z","tasks":[{"name":" "}]}`: {"name", "dueDate", "tasks[0].name"},
+		`{"name":"groceries","colour":"red"}`:                                 {"colour"},
+		`{"name":42}`:                                                         {"name"},
+	} {
+		request, _ := http.NewRequest("POST", "/v1/todo", strings.NewReader(payload))
+		responseRecorder := httptest.NewRecorder()
+		h.HandleAddTodo(responseRecorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Code)
+		var invalid models.ValidationError
+		json.NewDecoder(responseRecorder.Body).Decode(&invalid)
+		var got []string
+		for _, e := range invalid.Errors {
+			got = append(got, e.Field)
+		}
+		assert.Equal(t, fields, got, payload)
+	}
+}
+
 func TestTodoHandler_HandleAddTask(t *testing.T) {
 	mockRepo := repositories.MockTodoRepository{}
 	mockRepo.Clear()
@@ -75,16 +144,82 @@ func TestTodoHandler_HandleAddTask(t *testing.T) {
 	request = mux.SetURLVars(request, params)
 	responseRecorder := httptest.NewRecorder()
 
-	h := NewTodoHandler(mockRepo)
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
 	h.HandleAddTask(responseRecorder, request)
 
 	assert.Equal(t, http.StatusCreated, responseRecorder.Code)
+	var created models.Task
+	json.NewDecoder(responseRecorder.Body).Decode(&created)
+	assert.NotEqual(t, uuid.Nil, created.ID)
+	assert.Equal(t, task.Name, created.Name)
+	assert.Equal(t, fmt.Sprintf("/v1/todo/%s/task/%s", todoID, created.ID), responseRecorder.Header().Get("Location"))
 
 	val, _ = mockRepo.GetTodoByID(todoID)
 	assert.Equal(t, 2, len(val.Tasks))
 
 }
 
+func TestTodoHandler_HandleUpdateTask(t *testing.T) {
+	mockRepo := repositories.MockTodoRepository{}
+	mockRepo.Clear()
+
+	todoID := uuid.New()
+	todo := newTodoID(todoID)
+	mockRepo.AddTodo(todo)
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
+
+	update := func(taskID uuid.UUID) *httptest.ResponseRecorder {
+		url := fmt.Sprintf("/v1/todo/%s/task/%s/complete", todoID, taskID)
+		request, _ := http.NewRequest("PUT", url, strings.NewReader(`{"completed":true}`))
+		request = mux.SetURLVars(request, map[string]string{
+			"id":     todoID.String(),
+			"taskID": taskID.String(),
+		})
+		responseRecorder := httptest.NewRecorder()
+		h.HandleUpdateTask(responseRecorder, request)
+		return responseRecorder
+	}
+
+	completed := testutil.ToFloat64(metrics.TasksCompleted)
+	responseRecorder := update(todo.Tasks[0].ID)
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	var updated models.Task
+	json.NewDecoder(responseRecorder.Body).Decode(&updated)
+	assert.Equal(t, todo.Tasks[0].ID, updated.ID)
+	assert.True(t, updated.Completed)
+	assert.Equal(t, completed+1, testutil.ToFloat64(metrics.TasksCompleted))
+
+	// completing it again or an unknown task is not counted
+	assert.Equal(t, http.StatusOK, update(todo.Tasks[0].ID).Code)
+	assert.Equal(t, http.StatusNotFound, update(uuid.New()).Code)
+	assert.Equal(t, completed+1, testutil.ToFloat64(metrics.TasksCompleted))
+}
+
+func TestTodoHandler_HandleGetTask(t *testing.T) {
+	repo := repositories.NewMemoryTodoRepository()
+	todo := newTodo()
+	repo.AddTodo(context.Background(), todo)
+	h := NewTodoHandler(repo)
+
+	get := func(taskID uuid.UUID) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", fmt.Sprintf("/v1/todo/%s/task/%s", todo.ID, taskID), nil)
+		request = mux.SetURLVars(request, map[string]string{
+			"id":     todo.ID.String(),
+			"taskID": taskID.String(),
+		})
+		responseRecorder := httptest.NewRecorder()
+		h.HandleGetTask(responseRecorder, request)
+		return responseRecorder
+	}
+
+	responseRecorder := get(todo.Tasks[0].ID)
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	var task models.Task
+	json.NewDecoder(responseRecorder.Body).Decode(&task)
+	assert.Equal(t, todo.Tasks[0].Name, task.Name)
+	assert.Equal(t, http.StatusNotFound, get(uuid.New()).Code)
+}
+
 func TestTodoHandler_HandleAddTask_Duplicate(t *testing.T) {
 	mockRepo := repositories.MockTodoRepository{}
 	mockRepo.Clear()
@@ -107,7 +242,7 @@ func TestTodoHandler_HandleAddTask_Duplicate(t *testing.T) {
 	request = mux.SetURLVars(request, params)
 	responseRecorder := httptest.NewRecorder()
 
-	h := NewTodoHandler(mockRepo)
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
 	h.HandleAddTask(responseRecorder, request)
 
 	assert.Equal(t, http.StatusConflict, responseRecorder.Code)
@@ -136,7 +271,7 @@ func TestTodoHandler_HandleGetTodoList(t *testing.T) {
 	request, _ := http.NewRequest("GET", url, nil)
 	responseRecorder := httptest.NewRecorder()
 
-	h := NewTodoHandler(mockRepo)
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
 	h.HandleGetTodoList(responseRecorder, request)
 
 	assert.Equal(t, http.StatusOK, responseRecorder.Code)
@@ -153,6 +288,46 @@ func TestTodoHandler_HandleGetTodoList(t *testing.T) {
 	}
 }
 
+func TestTodoHandler_HandleGetTodoList_Stream(t *testing.T) {
+	mockRepo := repositories.MockTodoRepository{}
+	mockRepo.Clear()
+
+	var listID []uuid.UUID
+	for i := 0; i < 10; i++ {
+		listID = append(listID, uuid.New())
+	}
+	for _, id := range listID {
+		mockRepo.AddTodo(newTodoID(id))
+	}
+
+	h := NewTodoHandler(repositories.NewTodoRepositoryAdapter(mockRepo))
+
+	// JSON array
+	request, _ := http.NewRequest("GET", "/v1/todo?stream=true&skip=2&limit=5", nil)
+	responseRecorder := httptest.NewRecorder()
+	h.HandleGetTodoList(responseRecorder, request)
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	var todoList []models.Todo
+	err := json.NewDecoder(responseRecorder.Body).Decode(&todoList)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(todoList))
+	for i := 0; i < len(todoList); i++ {
+		assert.Equal(t, listID[2+i], todoList[i].ID)
+	}
+
+	// NDJSON
+	request, _ = http.NewRequest("GET", "/v1/todo", nil)
+	request.Header.Set("Accept", "application/x-ndjson")
+	responseRecorder = httptest.NewRecorder()
+	h.HandleGetTodoList(responseRecorder, request)
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.Equal(t, "application/x-ndjson; charset=utf-8", responseRecorder.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(responseRecorder.Body.String()), "\n")
+	assert.Equal(t, 10, len(lines))
+}
+
 func newTodo() models.Todo {
 	return newTodoID(uuid.New())
 }
@@ -182,3 +357,19 @@ func newTaskID(taskID uuid.UUID) models.Task {
 		Name: fmt.Sprintf("TASK:%v", taskID),
 	}
 }
+
+func TestTodoHandler_HandleAddTask_TooManyTasks(t *testing.T) {
+	repo := repositories.Chain(repositories.NewMemoryTodoRepository(), repositories.Quota(0, 0, 1))
+	todo := newTodo()
+	repo.AddTodo(context.Background(), todo)
+
+	bytes, _ := json.Marshal(newTask())
+	request, _ := http.NewRequest("POST", fmt.Sprintf("/v1/todo/%s/tasks", todo.ID), strings.NewReader(string(bytes)))
+	request = mux.SetURLVars(request, map[string]string{"id": todo.ID.String()})
+	responseRecorder := httptest.NewRecorder()
+
+	h := NewTodoHandler(repo)
+	h.HandleAddTask(responseRecorder, request)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, responseRecorder.Code)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elumbantoruan/todo/models"
+)
+
+const (
+	// streamJSONArray streams a JSON array, one element at a time
+	streamJSONArray = "json"
+	// streamNDJSON streams one JSON document per line
+	streamNDJSON = "ndjson"
+)
+
+// streamFormat returns the streaming format requested by r, or an empty string
+// when the list is to be encoded in one shot
+func streamFormat(r *http.Request) string {
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		return streamNDJSON
+	}
+	if stream, _ := strconv.ParseBool(r.URL.Query().Get("stream")); stream {
+		return streamJSONArray
+	}
+	return ""
+}
+
+// streamTodoList writes the todos matching search, skip and limit while
+// iterating over the repository, so memory does not grow with the list
+func (t *TodoHandler) streamTodoList(w http.ResponseWriter, r *http.Request, format string) {
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	skip, limit := filter.skip, filter.limit
+
+	it, err := t.repo.IterateTodo(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer it.Close()
+
+	// next returns the next todo to write
+	matched := 0
+	next := func() (models.Todo, bool) {
+		for it.Next() {
+			todo := it.Todo()
+			if !filter.matches(todo) {
+				continue
+			}
+			matched++
+			if matched <= skip {
+				continue
+			}
+			return todo, true
+		}
+		return models.Todo{}, false
+	}
+
+	// the status is only known once the first todo is found
+	todo, ok := next()
+	if !ok {
+		if it.Err() != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	if format == streamNDJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if format == streamJSONArray {
+		w.Write([]byte("["))
+	}
+	for written := 0; ok; written++ {
+		if format == streamJSONArray && written > 0 {
+			w.Write([]byte(","))
+		}
+		err = enc.Encode(todo)
+		if err != nil {
+			// the client went away
+			return
+		}
+		if limit > 0 && written+1 >= limit {
+			break
+		}
+		todo, ok = next()
+	}
+	if it.Err() != nil {
+		// the status is already sent, a truncated body is all we can do
+		slog.ErrorContext(r.Context(), "streaming todo list failed", "error", it.Err())
+		return
+	}
+	if format == streamJSONArray {
+		w.Write([]byte("]\n"))
+	}
+}
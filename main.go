@@ -1,46 +1,299 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/config"
 	"github.com/elumbantoruan/todo/handlers"
+	"github.com/elumbantoruan/todo/metrics"
+	"github.com/elumbantoruan/todo/middleware"
+	"github.com/elumbantoruan/todo/models"
 	"github.com/elumbantoruan/todo/repositories"
+	"github.com/elumbantoruan/todo/tracing"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+)
+
+// exit codes of the server
+const (
+	exitOK = 0
+	// exitError is returned when the server cannot start or stops on an error
+	exitError = 1
+	// exitDrainTimeout is returned when in-flight requests did not complete in time
+	exitDrainTimeout = 2
 )
 
 func main() {
 
-	m, err := registerHandlers()
+	// structured logs are written as JSON lines
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+
+	// maintenance commands, such as backup and restore, run instead of the server
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		err := runCommand(os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	os.Exit(serve(os.Args[1:]))
+}
+
+// serve runs the server until SIGINT or SIGTERM, then stops accepting connections,
+// drains in-flight requests and flushes the repository and pending spans.
+// It returns the exit code of the process
+func serve(args []string) int {
+	// the configuration is read from a file, the environment and args
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	cfg, err := config.Load(fs, args, os.Getenv)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		slog.Error("reading configuration", "error", err)
+		return exitError
+	}
+	if *printConfig {
+		err = cfg.WriteYAML(os.Stdout)
+		if err != nil {
+			slog.Error("printing configuration", "error", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// spans are exported as configured, pending ones are flushed on exit
+	shutdownTracing, err := tracing.Setup(tracing.Config{
+		ServiceName: "todo",
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+	})
+	if err != nil {
+		slog.Error("setting up tracing", "error", err)
+		return exitError
+	}
+
+	// creating an instance of the storage backend wrapped with the decorators
+	// selected by the configuration
+	repo, err := newTodoRepository(cfg)
 	if err != nil {
-		log.Panic(err)
+		slog.Error("creating repository", "error", err)
+		return exitError
 	}
-	http.Handle("/", m)
 
-	err = http.ListenAndServe(":5000", nil)
+	m, err := registerHandlers(cfg, repo)
 	if err != nil {
-		log.Panic(err)
+		slog.Error("registering handlers", "error", err)
+		return exitError
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           m,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}
+	if cfg.Server.TLS.Enabled() {
+		srv.TLSConfig, err = newTLSConfig(cfg.Server.TLS)
+		if err != nil {
+			slog.Error("configuring TLS", "error", err)
+			return exitError
+		}
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// the certificate is served by TLSConfig.GetCertificate
+			serveErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- srv.ListenAndServe()
+	}()
+	slog.Info("listening", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+
+	code := exitOK
+	select {
+	case err = <-serveErr:
+		slog.Error("serving", "error", err)
+		code = exitError
+	case <-ctx.Done():
+		// a second signal kills the process right away
+		stop()
+		slog.Info("shutting down, draining in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		err = srv.Shutdown(drainCtx)
+		cancel()
+		if err != nil {
+			slog.Error("draining in-flight requests", "error", err)
+			srv.Close()
+			code = exitDrainTimeout
+		}
+	}
+
+	// in-flight requests are done, flush what is left behind them
+	if closer, ok := repo.(io.Closer); ok {
+		err = closer.Close()
+		if err != nil {
+			slog.Error("closing repository", "error", err)
+			if code == exitOK {
+				code = exitError
+			}
+		}
 	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = shutdownTracing(flushCtx)
+	if err != nil {
+		slog.Error("flushing spans", "error", err)
+	}
+
+	slog.Info("stopped", "exitCode", code)
+	return code
 }
 
-func registerHandlers() (*mux.Router, error) {
+func registerHandlers(cfg config.Config, repo repositories.TodoRepositoryV2) (*mux.Router, error) {
 	m := mux.NewRouter()
 
-	// creating an instance of filerepository
-	fr := repositories.NewFileStorageTodoRepository("data")
-
 	// instance of handlers which requires a storage
-	handle := handlers.NewTodoHandler(fr)
+	handle := handlers.NewTodoHandler(repo)
+	batchHandle := handlers.NewBatchHandler(repo, cfg.Limits.MaxBatchOperations)
+	bulkHandle, err := handlers.NewBulkHandler(repo)
+	if err != nil {
+		return nil, err
+	}
+	backupHandle := handlers.NewBackupHandler(repo)
+	healthHandle := handlers.NewHealthHandler(handlers.BuildInfo{
+		Version:        version,
+		Commit:         buildCommit(),
+		GoVersion:      goVersion(),
+		StorageBackend: cfg.Storage.Describe(),
+		SchemaVersion:  models.SchemaVersion,
+	})
+	// there is no scheduler to check: the server runs no background jobs,
+	// a scheduler registers its own check here once there is one.
+	// With tenancy, the repository check and the business gauges only cover the default tenant
+	healthHandle.AddCheck("repository", handlers.RepositoryCheck(repo))
+	if cfg.Storage.Backend == config.BackendFile {
+		healthHandle.AddCheck("dataDir", handlers.WritableDirCheck(cfg.Storage.File.DataDir))
+	}
+
+	// every request gets a span continuing the traceparent of the caller,
+	// a request id and an access log line, requests are counted and timed
+	// per route, and business gauges are computed from the repository
+	// when /metrics is scraped
+	m.Use(otelmux.Middleware("todo"), middleware.RequestID, middleware.AccessLog(slog.Default()), middleware.Metrics(prometheus.DefaultRegisterer))
+
+	// callers presenting a verified client certificate are authenticated as its user
+	if cfg.Server.TLS.ClientAuth == config.ClientAuthRequest || cfg.Server.TLS.ClientAuth == config.ClientAuthRequire {
+		m.Use(middleware.ClientCertificate(cfg.Server.TLS.ClientUsers, cfg.Server.TLS.ClientScopes))
+	}
+	err = metrics.Register(prometheus.DefaultRegisterer, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// callers of the todo and backup routes must be granted the scope of the route,
+	// health, version and metrics stay open to probes and scrapers
+	scoped := func(scope string, h http.HandlerFunc) http.Handler {
+		return h
+	}
+	var users *auth.UserStore
+	if cfg.Auth.Enabled {
+		keys, err := auth.LoadKeyStore(cfg.Auth.APIKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		users, err = auth.LoadUserStore(cfg.Auth.UserFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys.List()) == 0 && len(users.List()) == 0 {
+			slog.Warn("authentication is enabled but no API key nor user exists, create one with the apikey or user command",
+				"apiKeyFile", cfg.Auth.APIKeyFile, "userFile", cfg.Auth.UserFile)
+		}
+		signingKey, err := auth.LoadOrCreateSigningKey(cfg.Auth.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens := auth.NewTokenIssuer(signingKey, cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+
+		authHandle := handlers.NewAuthHandler(users, tokens)
+		m.HandleFunc("/v1/auth/login", authHandle.HandleLogin).Methods("POST")
+		m.HandleFunc("/v1/auth/refresh", authHandle.HandleRefresh).Methods("POST")
+
+		m.Use(middleware.Authenticate(keys, tokens))
+		scoped = func(scope string, h http.HandlerFunc) http.Handler {
+			return middleware.RequireScope(scope, h)
+		}
+	}
+
+	// callers of the API are throttled once authenticated, so a user or an API key has
+	// the same limit from every address, and request bodies are capped.
+	// Probes and scrapers of the health, version and metrics routes are never throttled
+	routeLimits := make(map[string]middleware.Limit, len(cfg.Limits.Routes))
+	for route, limit := range cfg.Limits.Routes {
+		routeLimits[strings.Join(strings.Fields(route), " ")] = middleware.Limit{Rate: limit.Rate, Burst: limit.Burst}
+	}
+	m.Use(middleware.PathPrefix("/v1/", middleware.RateLimit(middleware.Limit{Rate: cfg.Limits.Rate, Burst: cfg.Limits.Burst}, routeLimits)),
+		middleware.MaxBodyBytes(int64(cfg.Limits.MaxBodyBytes)))
+
+	// with tenancy, the todo and backup routes reach the storage of the tenant of the request
+	if cfg.Tenancy.Enabled {
+		resolveTenant := middleware.Tenant(cfg.Tenancy.Header, cfg.Tenancy.Domain, cfg.Tenancy.DefaultTenant)
+		requireScope := scoped
+		scoped = func(scope string, h http.HandlerFunc) http.Handler {
+			return requireScope(scope, resolveTenant(h).ServeHTTP)
+		}
+	}
+
+	// retries of the creating routes carrying an Idempotency-Key get the first response again,
+	// keys are scoped to the caller and the tenant resolved by the outer middlewares
+	idempotent := middleware.Idempotency(middleware.NewIdempotencyStore(cfg.Idempotency.TTL))
 
 	// register the http handler for each operations
-	m.HandleFunc("/v1/todo", handle.HandleAddTodo).Methods("POST")
-	m.HandleFunc("/v1/todo/{id}/tasks", handle.HandleAddTask).Methods("POST")
-	m.HandleFunc("/v1/todo/{id}/task/{taskID}/complete", handle.HandleUpdateTask).Methods("PUT")
-	m.HandleFunc("/v1/todo", handle.HandleGetTodoList).Methods("GET") // may contains Queries("search", "{search}", "skip", "{skip}", "limit", "{limit}")
-	m.HandleFunc("/v1/todo/{id}", handle.HandleGetTodoByID).Methods("GET")
-	m.HandleFunc("/v1/todo/{id}", handle.HandleUpdateTodo).Methods("PUT")
-	m.HandleFunc("/v1/todo/{id}", handle.HandleDeleteTodo).Methods("DELETE")
-	m.HandleFunc("/v1/todo/{id}/task{taskID}", handle.HandleDeleteTask).Methods("DELETE")
+	m.Handle("/v1/todo", scoped(auth.ScopeTodoWrite, idempotent(http.HandlerFunc(handle.HandleAddTodo)).ServeHTTP)).Methods("POST")
+	m.Handle("/v1/todo/{id}/tasks", scoped(auth.ScopeTodoWrite, idempotent(http.HandlerFunc(handle.HandleAddTask)).ServeHTTP)).Methods("POST")
+	m.Handle("/v1/todo/{id}/task/{taskID}/complete", scoped(auth.ScopeTodoWrite, handle.HandleUpdateTask)).Methods("PUT")
+	m.Handle("/v1/todo", scoped(auth.ScopeTodoRead, handle.HandleGetTodoList)).Methods("GET") // may contains Queries("search", "{search}", "skip", "{skip}", "limit", "{limit}")
+	m.Handle("/v1/todo/{id}", scoped(auth.ScopeTodoRead, handle.HandleGetTodoByID)).Methods("GET")
+	m.Handle("/v1/todo/{id}", scoped(auth.ScopeTodoWrite, handle.HandleUpdateTodo)).Methods("PUT")
+	m.Handle("/v1/todo/{id}", scoped(auth.ScopeTodoWrite, handle.HandleDeleteTodo)).Methods("DELETE")
+	m.Handle("/v1/todo/{id}/task/{taskID}", scoped(auth.ScopeTodoRead, handle.HandleGetTask)).Methods("GET")
+	m.Handle("/v1/todo/{id}/task/{taskID}", scoped(auth.ScopeTodoWrite, handle.HandleDeleteTask)).Methods("DELETE")
+	// the path without the slash before the task id is kept for existing clients
+	m.Handle("/v1/todo/{id}/task{taskID}", scoped(auth.ScopeTodoWrite, handle.HandleDeleteTask)).Methods("DELETE")
+	m.Handle("/v1/todo/bulk", scoped(auth.ScopeTodoWrite, bulkHandle.HandleBulk)).Methods("POST")
+	m.Handle("/v1/batch", scoped(auth.ScopeTodoWrite, idempotent(http.HandlerFunc(batchHandle.HandleBatch)).ServeHTTP)).Methods("POST")
+	m.Handle("/v1/me/tasks", scoped(auth.ScopeTodoRead, handle.HandleGetMyTasks)).Methods("GET")
+	m.Handle("/v1/backup", scoped(auth.ScopeAdmin, backupHandle.HandleGetBackup)).Methods("GET")
+	if users != nil {
+		// todos are shared with the users of the user file, the repository checks the role of the caller
+		shareHandle := handlers.NewShareHandler(repo, users)
+		m.Handle("/v1/todo/{id}/collaborators/{username}", scoped(auth.ScopeTodoWrite, shareHandle.HandleShare)).Methods("PUT")
+		m.Handle("/v1/todo/{id}/collaborators/{username}", scoped(auth.ScopeTodoWrite, shareHandle.HandleUnshare)).Methods("DELETE")
+	}
+	m.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	m.HandleFunc("/healthz", healthHandle.HandleHealthz).Methods("GET")
+	m.HandleFunc("/readyz", healthHandle.HandleReadyz).Methods("GET")
+	m.HandleFunc("/version", healthHandle.HandleVersion).Methods("GET")
 
 	return m, nil
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elumbantoruan/todo/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterHandlers_RateLimit(t *testing.T) {
+	cfg, err := config.Load(nil, nil, func(string) string { return "" })
+	assert.Nil(t, err)
+	cfg.Storage.Backend = config.BackendMemory
+	cfg.Auth.Enabled = false
+	cfg.Limits.Rate, cfg.Limits.Burst = 0.001, 1
+	repo, err := newTodoRepository(cfg)
+	assert.Nil(t, err)
+	m, err := registerHandlers(cfg, repo)
+	assert.Nil(t, err)
+
+	serve := func(path string) int {
+		request, _ := http.NewRequest("GET", path, nil)
+		responseRecorder := httptest.NewRecorder()
+		m.ServeHTTP(responseRecorder, request)
+		return responseRecorder.Code
+	}
+
+	// probes and scrapers are never throttled
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve("/healthz"))
+		assert.Equal(t, http.StatusOK, serve("/readyz"))
+		assert.Equal(t, http.StatusOK, serve("/metrics"))
+	}
+	assert.NotEqual(t, http.StatusTooManyRequests, serve("/v1/todo"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/v1/todo"))
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CacheCollector exports the statistics of the caches of the repositories,
+// labelled with the tenant of each cache
+type CacheCollector struct {
+	mu     sync.Mutex
+	caches map[string]*repositories.CachedTodoRepository
+
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	entries   *prometheus.Desc
+}
+
+// NewCacheCollector creates a CacheCollector exporting no cache yet
+func NewCacheCollector() *CacheCollector {
+	labels := []string{"tenant"}
+	return &CacheCollector{
+		caches: make(map[string]*repositories.CachedTodoRepository),
+		hits: prometheus.NewDesc("todo_cache_hits_total",
+			"Number of reads served by the cache.", labels, nil),
+		misses: prometheus.NewDesc("todo_cache_misses_total",
+			"Number of reads passed on to the storage by the cache.", labels, nil),
+		evictions: prometheus.NewDesc("todo_cache_evictions_total",
+			"Number of entries evicted from the cache.", labels, nil),
+		entries: prometheus.NewDesc("todo_cache_entries",
+			"Number of entries in the cache.", labels, nil),
+	}
+}
+
+// Add exports the statistics of cache, the cache of the storage of tenantID,
+// empty without tenancy
+func (c *CacheCollector) Add(tenantID string, cache *repositories.CachedTodoRepository) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.caches[tenantID] = cache
+}
+
+// Describe implements prometheus.Collector
+func (c *CacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.entries
+}
+
+// Collect implements prometheus.Collector
+func (c *CacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	caches := make(map[string]*repositories.CachedTodoRepository, len(c.caches))
+	for tenantID, cache := range c.caches {
+		caches[tenantID] = cache
+	}
+	c.mu.Unlock()
+
+	for tenantID, cache := range caches {
+		stats := cache.Stats()
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits), tenantID)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses), tenantID)
+		ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions), tenantID)
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries), tenantID)
+	}
+}
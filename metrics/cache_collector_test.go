@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCollector(t *testing.T) {
+	ctx := context.Background()
+	cache := repositories.NewCachedTodoRepository(repositories.NewMemoryTodoRepository(), 1, time.Minute)
+	first, second := uuid.New(), uuid.New()
+	cache.AddTodo(ctx, models.Todo{ID: first, Name: "first"})
+	cache.AddTodo(ctx, models.Todo{ID: second, Name: "second"})
+	cache.GetTodoByID(ctx, first)
+	cache.GetTodoByID(ctx, first)
+	cache.GetTodoByID(ctx, second)
+	stats := cache.Stats()
+	assert.NotZero(t, stats.Hits)
+
+	caches := NewCacheCollector()
+	caches.Add("acme", cache)
+	reg := prometheus.NewRegistry()
+	assert.Nil(t, reg.Register(caches))
+
+	expected := fmt.Sprintf(`
+# HELP todo_cache_entries Number of entries in the cache.
+# TYPE todo_cache_entries gauge
+todo_cache_entries{tenant="acme"} %d
+# HELP todo_cache_evictions_total Number of entries evicted from the cache.
+# TYPE todo_cache_evictions_total counter
+todo_cache_evictions_total{tenant="acme"} %d
+# HELP todo_cache_hits_total Number of reads served by the cache.
+# TYPE todo_cache_hits_total counter
+todo_cache_hits_total{tenant="acme"} %d
+# HELP todo_cache_misses_total Number of reads passed on to the storage by the cache.
+# TYPE todo_cache_misses_total counter
+todo_cache_misses_total{tenant="acme"} %d
+`, stats.Entries, stats.Evictions, stats.Hits, stats.Misses)
+	assert.Nil(t, testutil.GatherAndCompare(reg, strings.NewReader(expected)))
+}
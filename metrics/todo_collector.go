@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TasksCompleted counts the tasks marked as completed.
+// The number of tasks completed per day is increase(todo_tasks_completed_total[1d])
+var TasksCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "todo_tasks_completed_total",
+	Help: "Number of tasks marked as completed.",
+})
+
+// todoCollector computes business gauges from the repository at scrape time
+type todoCollector struct {
+	repo    repositories.TodoRepositoryV2
+	timeout time.Duration
+
+	todos   *prometheus.Desc
+	open    *prometheus.Desc
+	overdue *prometheus.Desc
+}
+
+// Register registers TasksCompleted and the gauges computed from repo with reg.
+// The gauges are computed without a tenant, so with tenancy they only count
+// the todos of the default tenant
+func Register(reg prometheus.Registerer, repo repositories.TodoRepositoryV2) error {
+	collector := &todoCollector{
+		repo:    repo,
+		timeout: 10 * time.Second,
+		todos: prometheus.NewDesc("todo_todos",
+			"Number of todos.", nil, nil),
+		open: prometheus.NewDesc("todo_todos_open",
+			"Number of todos which are not completed.", nil, nil),
+		overdue: prometheus.NewDesc("todo_todos_overdue",
+			"Number of todos which are not completed and past their due date.", nil, nil),
+	}
+	err := reg.Register(collector)
+	if err != nil {
+		return err
+	}
+	return reg.Register(TasksCompleted)
+}
+
+// Describe implements prometheus.Collector
+func (c *todoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.todos
+	ch <- c.open
+	ch <- c.overdue
+}
+
+// Collect implements prometheus.Collector
+// It iterates over every todo, so memory does not grow with the store
+func (c *todoCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var (
+		todos   int
+		open    int
+		overdue int
+		now     = time.Now()
+	)
+	it, err := c.repo.IterateTodo(ctx)
+	if err == nil {
+		for it.Next() {
+			todo := it.Todo()
+			todos++
+			if todo.Completed {
+				continue
+			}
+			open++
+			if todo.DueDate != nil && todo.DueDate.Before(now) {
+				overdue++
+			}
+		}
+		err = it.Err()
+		it.Close()
+	}
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.todos, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.todos, prometheus.GaugeValue, float64(todos))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(open))
+	ch <- prometheus.MustNewConstMetric(c.overdue, prometheus.GaugeValue, float64(overdue))
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister_Tenancy(t *testing.T) {
+	repo := repositories.NewTenantTodoRepository("default", func(tenantID string) (repositories.TodoRepositoryV2, error) {
+		return repositories.NewMemoryTodoRepository(), nil
+	})
+	ctx := context.Background()
+	acme := tenant.NewContext(ctx, "acme")
+	repo.AddTodo(ctx, models.Todo{ID: uuid.New(), Name: "default"})
+	repo.AddTodo(acme, models.Todo{ID: uuid.New(), Name: "acme"})
+	repo.AddTodo(acme, models.Todo{ID: uuid.New(), Name: "acme", Completed: true})
+
+	reg := prometheus.NewRegistry()
+	assert.Nil(t, Register(reg, repo))
+
+	// the gauges only count the todos of the default tenant
+	expected := `
+# HELP todo_todos Number of todos.
+# TYPE todo_todos gauge
+todo_todos 1
+# HELP todo_todos_open Number of todos which are not completed.
+# TYPE todo_todos_open gauge
+todo_todos_open 1
+`
+	assert.Nil(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "todo_todos", "todo_todos_open"))
+}
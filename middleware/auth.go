@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHeader is the http header carrying an API key, as an alternative to a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// Authenticate authenticates requests carrying an API key of keys, either as a
+// bearer token of the Authorization header or in the X-API-Key header, or carrying
+// an access token of tokens as a bearer token.
+// Invalid credentials are rejected with 401, requests without credentials are passed on
+// so RequireScope can reject them when the route is protected
+func Authenticate(keys *auth.KeyStore, tokens *auth.TokenIssuer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			bearer := ""
+			if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+				bearer = strings.TrimPrefix(h, "Bearer ")
+			}
+			if auth.IsAPIKey(bearer) {
+				key, bearer = bearer, ""
+			}
+
+			var (
+				p   auth.Principal
+				err error
+			)
+			switch {
+			case bearer != "":
+				var claims *auth.Claims
+				claims, err = tokens.Verify(bearer, auth.TokenAccess)
+				if err == nil {
+					p = claims.Principal()
+				}
+			case key != "":
+				p, err = keys.Authenticate(key)
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err == auth.ErrInvalidKey || err == auth.ErrInvalidToken {
+				unauthorized(w)
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
+		})
+	}
+}
+
+// RequireScope serves next to callers granted scope. It responds with 401
+// when the caller is not authenticated, and with 403 when it lacks scope
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.FromContext(r.Context())
+		if !ok {
+			unauthorized(w)
+			return
+		}
+		if !p.HasScope(scope) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="todo"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate_RequireScope(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+	keys, _ := auth.LoadKeyStore(filepath.Join(dir, "apikeys.json"))
+	reader, _, _ := keys.Create("reader", "", []string{auth.ScopeTodoRead})
+	writer, _, _ := keys.Create("writer", "", []string{auth.ScopeTodoWrite})
+
+	tokens := auth.NewTokenIssuer([]byte("0123456789abcdef0123456789abcdef"), time.Minute, time.Hour)
+	issued, _ := tokens.Issue(auth.User{ID: "42", Name: "alice", Scopes: []string{auth.ScopeTodoWrite}})
+	handler := Authenticate(keys, tokens)(RequireScope(auth.ScopeTodoWrite,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	for key, expected := range map[string]int{
+		"":                  http.StatusUnauthorized,
+		"todo_bad_key":      http.StatusUnauthorized,
+		reader:              http.StatusForbidden,
+		writer:              http.StatusOK,
+		"not.a.jwt":         http.StatusUnauthorized,
+		issued.AccessToken:  http.StatusOK,
+		issued.RefreshToken: http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("DELETE", "/v1/todo/1", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, expected, rr.Code, key)
+	}
+
+	// the key can also be given in the X-API-Key header
+	req := httptest.NewRequest("DELETE", "/v1/todo/1", nil)
+	req.Header.Set(APIKeyHeader, writer)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/gorilla/mux"
+)
+
+// ClientCertificate authenticates requests made with a verified TLS client certificate,
+// granting scopes. The subject of the certificate is mapped to a user by users, or else
+// the common name is the user. Requests without a verified certificate are passed on unauthenticated
+func ClientCertificate(users map[string]string, scopes []string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			subject := r.TLS.VerifiedChains[0][0].Subject
+			user, ok := users[subject.String()]
+			if !ok {
+				user = subject.CommonName
+			}
+			if user == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := auth.NewContext(r.Context(), auth.Principal{
+				User:   user,
+				UserID: "cert:" + user,
+				Method: auth.MethodClientCertificate,
+				Scopes: scopes,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCertificate(t *testing.T) {
+	var user string
+	handler := ClientCertificate(map[string]string{"CN=ci,O=acme": "build-bot"}, nil)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := auth.FromContext(r.Context())
+			user = p.User
+		}))
+
+	for subject, expected := range map[string]string{
+		"ci":    "build-bot",
+		"alice": "alice",
+	} {
+		req := httptest.NewRequest("GET", "/v1/todo", nil)
+		req.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: subject, Organization: []string{"acme"}}},
+			}},
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, expected, user)
+	}
+
+	// requests without a verified certificate are not authenticated
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/todo", nil))
+	assert.Equal(t, "", user)
+}
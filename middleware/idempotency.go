@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// IdempotencyKeyHeader carries the key making the retries of a POST idempotent
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the length of the longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders are the headers of a response stored with it
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// IdempotencyStore holds the responses to the requests made with an idempotency key,
+// in memory, until their TTL expires
+type IdempotencyStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	responses map[string]*storedResponse
+	lastSweep time.Time
+}
+
+// storedResponse is the response to the first request made with a key
+type storedResponse struct {
+	// fingerprint is the hash of the payload of the request
+	fingerprint [sha256.Size]byte
+	// done is false while the first request is in flight
+	done    bool
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// NewIdempotencyStore creates an IdempotencyStore keeping responses for ttl
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:       ttl,
+		responses: make(map[string]*storedResponse),
+	}
+}
+
+// Idempotency makes the POST requests carrying an Idempotency-Key header idempotent.
+// The response to the first request with a key is stored in store, and retries with
+// the same key and payload get it again, with an Idempotent-Replayed header.
+// A key reused with another payload gets 422, and a retry made while the first request
+// is in flight gets 409. Keys are scoped to the caller and the tenant. Responses with
+// a 5xx status are not stored, so the request can be retried
+func Idempotency(store *IdempotencyStore) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			payload, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+				} else {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+
+			var userID string
+			if p, ok := auth.FromContext(r.Context()); ok {
+				userID = p.UserID
+			}
+			key = userID + "\x00" + tenant.FromContext(r.Context()) + "\x00" + r.URL.Path + "\x00" + key
+			fingerprint := sha256.Sum256(payload)
+
+			stored, first := store.start(key, fingerprint, time.Now())
+			switch {
+			case first:
+			case stored.fingerprint != fingerprint:
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			case !stored.done:
+				w.WriteHeader(http.StatusConflict)
+				return
+			default:
+				for name, values := range stored.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.status)
+				w.Write(stored.body)
+				return
+			}
+
+			// a panicking handler leaves no response to replay, the key is forgotten
+			// so retries are served instead of getting 409 until the process restarts
+			finished := false
+			defer func() {
+				if !finished {
+					store.forget(key)
+				}
+			}()
+			rw := &recordingWriter{responseWriter: newResponseWriter(w)}
+			next.ServeHTTP(rw, r)
+			header := make(http.Header)
+			for _, name := range replayedHeaders {
+				if values := w.Header().Values(name); len(values) > 0 {
+					header[name] = values
+				}
+			}
+			store.finish(key, rw.Status(), header, rw.body.Bytes())
+			finished = true
+		})
+	}
+}
+
+// start returns the response stored for key, or stores an in-flight
+// response for key and fingerprint and reports it is the first request
+func (s *IdempotencyStore) start(key string, fingerprint [sha256.Size]byte, now time.Time) (*storedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, stored := range s.responses {
+			if stored.done && now.After(stored.expires) {
+				delete(s.responses, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if stored, ok := s.responses[key]; ok && !(stored.done && now.After(stored.expires)) {
+		return stored, false
+	}
+	stored := &storedResponse{fingerprint: fingerprint}
+	s.responses[key] = stored
+	return stored, true
+}
+
+// finish stores the response to the first request made with key, or forgets
+// the key when the request failed on the server side
+func (s *IdempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status >= http.StatusInternalServerError {
+		delete(s.responses, key)
+		return
+	}
+	stored := s.responses[key]
+	stored.done = true
+	stored.status = status
+	stored.header = header
+	stored.body = body
+	stored.expires = time.Now().Add(s.ttl)
+}
+
+// forget drops the in-flight response of key
+func (s *IdempotencyStore) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.responses, key)
+}
+
+// recordingWriter records the body written through a responseWriter
+type recordingWriter struct {
+	*responseWriter
+	body bytes.Buffer
+}
+
+// Write records b and writes it
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.responseWriter.Write(b)
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	var created int
+	h := Idempotency(NewIdempotencyStore(time.Hour))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		created++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/v1/todo/%d", created))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d}`, created)
+	}))
+
+	do := func(path, key, body string, p *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		if p != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), *p))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// a retry gets the first response again
+	rr := do("/v1/todo", "k1", `{"name":"a"}`, nil)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, `{"id":1}`, rr.Body.String())
+	rr = do("/v1/todo", "k1", `{"name":"a"}`, nil)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, `{"id":1}`, rr.Body.String())
+	assert.Equal(t, "/v1/todo/1", rr.Header().Get("Location"))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, created)
+
+	// a key reused with another payload is rejected
+	assert.Equal(t, http.StatusUnprocessableEntity, do("/v1/todo", "k1", `{"name":"b"}`, nil).Code)
+
+	// keys are scoped to the caller, requests without a key are not stored
+	assert.Equal(t, `{"id":2}`, do("/v1/todo", "k1", `{"name":"a"}`, &auth.Principal{UserID: "alice"}).Body.String())
+	assert.Equal(t, `{"id":3}`, do("/v1/todo", "", `{"name":"a"}`, nil).Body.String())
+	assert.Equal(t, `{"id":4}`, do("/v1/todo", "", `{"name":"a"}`, nil).Body.String())
+
+	// server errors are not stored, so the request can be retried
+	assert.Equal(t, http.StatusInternalServerError, do("/v1/fail", "k2", `{}`, nil).Code)
+	rr = do("/v1/fail", "k2", `{}`, nil)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+
+	assert.Equal(t, http.StatusBadRequest, do("/v1/todo", strings.Repeat("k", 256), `{}`, nil).Code)
+}
+
+func TestIdempotencyStore_Expires(t *testing.T) {
+	s := NewIdempotencyStore(time.Minute)
+	now := time.Now()
+	_, first := s.start("k", [32]byte{1}, now)
+	assert.True(t, first)
+	stored, first := s.start("k", [32]byte{1}, now)
+	assert.False(t, first)
+	assert.False(t, stored.done)
+
+	s.finish("k", http.StatusCreated, nil, nil)
+	_, first = s.start("k", [32]byte{1}, now)
+	assert.False(t, first)
+	_, first = s.start("k", [32]byte{2}, now.Add(2*time.Minute))
+	assert.True(t, first)
+}
+
+func TestIdempotency_Panic(t *testing.T) {
+	panics := true
+	h := Idempotency(NewIdempotencyStore(time.Hour))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panics {
+			panic("handler failed")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/todo", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Panics(t, func() { do() })
+	// the retry is served rather than rejected as in flight
+	panics = false
+	assert.Equal(t, http.StatusCreated, do().Code)
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/elumbantoruan/todo/requestid"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLength bounds the request id accepted from clients
+const maxRequestIDLength = 128
+
+// RequestID propagates the X-Request-ID header of the request, or assigns
+// a new one, to the response and to the request context
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// AccessLog writes one structured line per request with the request id,
+// the route template, the status, the bytes written, the duration and the todo id.
+// It is meant to be installed with mux.Router.Use after RequestID
+func AccessLog(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			attrs := []interface{}{
+				slog.String("requestID", requestid.FromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("route", routeTemplate(r)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rw.Status()),
+				slog.Int("bytes", rw.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote", r.RemoteAddr),
+			}
+			if id, ok := mux.Vars(r)["id"]; ok {
+				attrs = append(attrs, slog.String("todoID", id))
+			}
+			if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+				attrs = append(attrs, slog.String("traceID", sc.TraceID().String()))
+			}
+			logger.Info("request", attrs...)
+		})
+	}
+}
+
+// validRequestID accepts short printable ascii ids only, so a client
+// cannot inject anything in the logs
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elumbantoruan/todo/requestid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID_AccessLog(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+
+	var handlerRequestID string
+	m := mux.NewRouter()
+	m.Use(RequestID, AccessLog(logger))
+	m.HandleFunc("/v1/todo/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerRequestID = requestid.FromContext(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("{}"))
+	}).Methods("GET")
+
+	request, _ := http.NewRequest("GET", "/v1/todo/42", nil)
+	request.Header.Set(requestid.Header, "abc-123")
+	responseRecorder := httptest.NewRecorder()
+	m.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, "abc-123", responseRecorder.Header().Get(requestid.Header))
+	assert.Equal(t, "abc-123", handlerRequestID)
+
+	var line map[string]interface{}
+	json.NewDecoder(&buffer).Decode(&line)
+	assert.Equal(t, "abc-123", line["requestID"])
+	assert.Equal(t, "/v1/todo/{id}", line["route"])
+	assert.Equal(t, float64(http.StatusAccepted), line["status"])
+	assert.Equal(t, float64(2), line["bytes"])
+	assert.Equal(t, "42", line["todoID"])
+}
+
+func TestRequestID_Generated(t *testing.T) {
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request, _ := http.NewRequest("GET", "/v1/todo", nil)
+	request.Header.Set(requestid.Header, "bad id\n")
+	responseRecorder := httptest.NewRecorder()
+	h.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, 36, len(responseRecorder.Header().Get(requestid.Header)))
+}
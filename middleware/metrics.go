@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics counts requests and records their latency per method, route template
+// and status code, registered with reg.
+// It is meant to be installed with mux.Router.Use so the route is known
+func Metrics(reg prometheus.Registerer) mux.MiddlewareFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "todo_http_requests_total",
+		Help: "Number of HTTP requests.",
+	}, []string{"method", "route", "code"})
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "todo_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+	reg.MustRegister(requests, latency)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			route := routeTemplate(r)
+			code := strconv.Itoa(rw.Status())
+			requests.WithLabelValues(r.Method, route, code).Inc()
+			latency.WithLabelValues(r.Method, route, code).Observe(time.Since(start).Seconds())
+		})
+	}
+}
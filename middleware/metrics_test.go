@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := mux.NewRouter()
+	m.Use(Metrics(reg))
+	m.HandleFunc("/v1/todo/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest("GET", "/v1/todo/1", nil)
+		m.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	expected := `
+# HELP todo_http_requests_total Number of HTTP requests.
+# TYPE todo_http_requests_total counter
+todo_http_requests_total{code="404",method="GET",route="/v1/todo/{id}"} 2
+`
+	err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "todo_http_requests_total")
+	assert.Nil(t, err)
+}
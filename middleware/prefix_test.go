@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathPrefix(t *testing.T) {
+	teapot := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+	h := PathPrefix("/v1/", teapot)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusTeapot, do("/v1/todo"))
+	assert.Equal(t, http.StatusOK, do("/healthz"))
+	assert.Equal(t, http.StatusOK, do("/v1"))
+}
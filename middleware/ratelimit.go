@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/gorilla/mux"
+)
+
+// Limit is the rate of a token bucket
+type Limit struct {
+	// Rate is the number of requests per second, 0 does not limit them
+	Rate float64
+	// Burst is the number of requests made at once
+	Burst int
+}
+
+// RateLimit throttles each caller with a token bucket, the caller being the authenticated
+// user or API key, or else the client IP. Routes listed in routes, keyed by method and path
+// template such as "POST /v1/todo", have their own bucket and limit, the other routes share
+// a bucket limited by limit. Throttled requests get 429 with a Retry-After header
+func RateLimit(limit Limit, routes map[string]Limit) mux.MiddlewareFunc {
+	l := &limiter{
+		buckets: make(map[string]*bucket),
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, lim := "*", limit
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					if routeLimit, ok := routes[r.Method+" "+template]; ok {
+						key, lim = r.Method+" "+template, routeLimit
+					}
+				}
+			}
+			if lim.Rate <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wait := l.take(key+" "+caller(r), lim, time.Now())
+			if wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// caller identifies the caller of r for rate limiting
+func caller(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		return p.UserID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// sweepInterval is how often the buckets which refilled are dropped
+const sweepInterval = time.Minute
+
+// limiter holds a token bucket per caller and route
+type limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// take takes a token from the bucket of key, and returns 0, or else
+// how long until the bucket has one
+func (l *limiter) take(key string, lim Limit, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := float64(lim.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if now.Sub(l.lastSweep) > sweepInterval {
+		// a bucket which refilled is the same as a new one
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= b.refill {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: burst,
+			last:   now,
+			refill: time.Duration(burst / lim.Rate * float64(time.Second)),
+		}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*lim.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / lim.Rate * float64(time.Second))
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// refill is the time an empty bucket takes to fill up
+	refill time.Duration
+}
+
+// MaxBodyBytes caps the size of request bodies to n bytes. Requests announcing
+// a larger body get 413, reading past n bytes of a body fails
+func MaxBodyBytes(n int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	m := mux.NewRouter()
+	m.Use(RateLimit(Limit{Rate: 1, Burst: 2}, map[string]Limit{
+		"POST /v1/todo":     {Rate: 0.5, Burst: 1},
+		"GET /v1/todo/{id}": {},
+	}))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	m.HandleFunc("/v1/todo", ok).Methods("GET", "POST")
+	m.HandleFunc("/v1/todo/{id}", ok).Methods("GET")
+
+	do := func(method, path, addr string, p *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = addr
+		if p != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), *p))
+		}
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the burst is spent, then the caller waits for the next token
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/todo", "10.0.0.1:1234", nil).Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/todo", "10.0.0.1:1234", nil).Code)
+	rr := do("GET", "/v1/todo", "10.0.0.1:4321", nil)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	// routes with their own limit have their own bucket
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/todo", "10.0.0.1:1234", nil).Code)
+	rr = do("POST", "/v1/todo", "10.0.0.1:1234", nil)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, do("GET", "/v1/todo/1", "10.0.0.1:1234", nil).Code)
+	}
+
+	// other addresses and authenticated callers have their own bucket
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/todo", "10.0.0.2:1234", nil).Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/todo", "10.0.0.1:1234", &auth.Principal{UserID: "alice"}).Code)
+}
+
+func TestLimiter_Refill(t *testing.T) {
+	l := &limiter{buckets: make(map[string]*bucket)}
+	now := time.Now()
+	lim := Limit{Rate: 10, Burst: 1}
+	assert.Equal(t, time.Duration(0), l.take("alice", lim, now))
+	assert.Equal(t, 100*time.Millisecond, l.take("alice", lim, now))
+	assert.Equal(t, time.Duration(0), l.take("alice", lim, now.Add(100*time.Millisecond)))
+
+	// refilled buckets are dropped
+	l.take("bob", lim, now.Add(time.Hour))
+	assert.Equal(t, 1, len(l.buckets))
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	var readErr error
+	handler := MaxBodyBytes(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = r.Body.Read(make([]byte, 16))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/todo", strings.NewReader(`{"name":"groceries"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	// bodies of unknown length fail when read past the limit
+	req := httptest.NewRequest("POST", "/v1/todo", strings.NewReader(`{"name":"groceries"}`))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotNil(t, readErr)
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/gorilla/mux"
+)
+
+// Tenant resolves the tenant of each request and carries it in the request context.
+// A caller bound to a tenant by its token or API key always gets that tenant. Admins
+// and unauthenticated callers name the tenant with the header, or with the subdomain
+// of domain when domain is set, and get defaultTenant otherwise. Other callers get
+// defaultTenant. Naming another tenant than the one the caller gets is forbidden
+func Tenant(header, domain, defaultTenant string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested := r.Header.Get(header)
+			if requested == "" && domain != "" {
+				requested = subdomain(r.Host, domain)
+			}
+
+			id := requested
+			p, ok := auth.FromContext(r.Context())
+			switch {
+			case ok && p.Tenant != "":
+				id = p.Tenant
+			case ok && !p.HasScope(auth.ScopeAdmin):
+				id = defaultTenant
+			case id == "":
+				id = defaultTenant
+			}
+			if requested != "" && requested != id {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if !tenant.Valid(id) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), id)))
+		})
+	}
+}
+
+// subdomain returns the label of host in front of domain, or an empty string
+func subdomain(host, domain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(domain)
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	return strings.TrimSuffix(host, suffix)
+}
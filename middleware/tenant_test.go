@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant(t *testing.T) {
+	var resolved string
+	handler := Tenant(tenant.Header, "todo.example.com", "default")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resolved = tenant.FromContext(r.Context())
+		}))
+
+	for _, c := range []struct {
+		name      string
+		principal *auth.Principal
+		host      string
+		header    string
+		code      int
+		tenant    string
+	}{
+		{name: "default", host: "localhost:5000", code: http.StatusOK, tenant: "default"},
+		{name: "header", host: "localhost:5000", header: "acme", code: http.StatusOK, tenant: "acme"},
+		{name: "subdomain", host: "acme.todo.example.com:443", code: http.StatusOK, tenant: "acme"},
+		{name: "invalid", host: "localhost", header: "../acme", code: http.StatusBadRequest},
+		{name: "bound", principal: &auth.Principal{UserID: "alice", Tenant: "acme"}, host: "localhost", code: http.StatusOK, tenant: "acme"},
+		{name: "bound elsewhere", principal: &auth.Principal{UserID: "alice", Tenant: "acme"}, host: "globex.todo.example.com", code: http.StatusForbidden},
+		{name: "unbound", principal: &auth.Principal{UserID: "bob"}, host: "localhost", header: "acme", code: http.StatusForbidden},
+		{name: "admin", principal: &auth.Principal{UserID: "root", Scopes: []string{auth.ScopeAdmin}}, host: "localhost", header: "acme", code: http.StatusOK, tenant: "acme"},
+	} {
+		resolved = ""
+		req := httptest.NewRequest("GET", "/v1/todo", nil)
+		req.Host = c.host
+		if c.header != "" {
+			req.Header.Set(tenant.Header, c.header)
+		}
+		if c.principal != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), *c.principal))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, c.code, rr.Code, c.name)
+		assert.Equal(t, c.tenant, resolved, c.name)
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AssignedTask is a task listed with its todo, such as in the tasks assigned to a user
+type AssignedTask struct {
+	Task
+	TodoID   uuid.UUID  `json:"todoId"`
+	TodoName string     `json:"todoName"`
+	DueDate  *time.Time `json:"dueDate"`
+}
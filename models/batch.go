@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Operations of a batch
+const (
+	OpCreateTodo   = "createTodo"
+	OpAddTask      = "addTask"
+	OpCompleteTask = "completeTask"
+	OpUpdateTodo   = "updateTodo"
+	OpDeleteTodo   = "deleteTodo"
+	OpDeleteTask   = "deleteTask"
+)
+
+// batchOps lists the operations of a batch, in the order they are documented
+var batchOps = []string{OpCreateTodo, OpAddTask, OpCompleteTask, OpUpdateTodo, OpDeleteTodo, OpDeleteTask}
+
+// BatchRequest is an ordered list of operations applied in one call
+type BatchRequest struct {
+	// Atomic applies every operation or none of them
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is an operation of a batch. Op tells which of
+// the other fields are used
+type BatchOperation struct {
+	Op     string    `json:"op"`
+	TodoID uuid.UUID `json:"todoId"`
+	TaskID uuid.UUID `json:"taskId"`
+	// Todo is the todo created by createTodo
+	Todo *Todo `json:"todo,omitempty"`
+	// Task is the task added by addTask
+	Task *Task `json:"task,omitempty"`
+	// Completed is set by completeTask and updateTodo
+	Completed bool `json:"completed"`
+	// DueDate is set by updateTodo
+	DueDate *time.Time `json:"dueDate"`
+}
+
+// BatchResponse reports the result of every operation of a batch, in order
+type BatchResponse struct {
+	// Committed reports whether the successful operations were kept,
+	// it is false when an atomic batch was rolled back
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchResult is the result of an operation of a batch
+type BatchResult struct {
+	// Status is the http status the operation gets on its own route
+	Status int `json:"status"`
+	// ID is the id of the created todo or task
+	ID string `json:"id,omitempty"`
+	// Location is the path of the created todo or task
+	Location string `json:"location,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Validate trims the text fields of the operations and returns a ValidationError
+// listing every rule they violate, or nil
+func (b *BatchRequest) Validate() error {
+	var v validator
+	if len(b.Operations) == 0 {
+		v.add("operations", "is required")
+	}
+	for i := range b.Operations {
+		b.Operations[i].validate(&v, fmt.Sprintf("operations[%d].", i))
+	}
+	return v.err()
+}
+
+// validate records the violations of o, its fields prefixed with prefix
+func (o *BatchOperation) validate(v *validator, prefix string) {
+	requireTodoID := func() {
+		if o.TodoID == uuid.Nil {
+			v.add(prefix+"todoId", "is required")
+		}
+	}
+	requireTaskID := func() {
+		if o.TaskID == uuid.Nil {
+			v.add(prefix+"taskId", "is required")
+		}
+	}
+
+	switch o.Op {
+	case OpCreateTodo:
+		if o.Todo == nil {
+			v.add(prefix+"todo", "is required")
+			return
+		}
+		o.Todo.validate(v, prefix+"todo.")
+	case OpAddTask:
+		requireTodoID()
+		if o.Task == nil {
+			v.add(prefix+"task", "is required")
+			return
+		}
+		o.Task.validate(v, prefix+"task.")
+	case OpCompleteTask, OpDeleteTask:
+		requireTodoID()
+		requireTaskID()
+	case OpUpdateTodo:
+		requireTodoID()
+		v.dueDate(prefix+"dueDate", o.DueDate, time.Now())
+	case OpDeleteTodo:
+		requireTodoID()
+	case "":
+		v.add(prefix+"op", "is required")
+	default:
+		v.add(prefix+"op", "must be one of %s", strings.Join(batchOps, ", "))
+	}
+}
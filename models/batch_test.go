@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchRequest_Validate(t *testing.T) {
+	batch := BatchRequest{Operations: []BatchOperation{
+		{Op: OpCreateTodo, Todo: &Todo{Name: " plan "}},
+		{Op: OpAddTask, Task: &Task{}},
+		{Op: OpCompleteTask, TodoID: uuid.New()},
+		{Op: "archive"},
+	}}
+	err := batch.Validate()
+	var fields []string
+	for _, e := range err.(*ValidationError).Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.Equal(t, []string{"operations[1].todoId", "operations[1].task.name", "operations[2].taskId", "operations[3].op"}, fields)
+	assert.Equal(t, "plan", batch.Operations[0].Todo.Name)
+
+	assert.NotNil(t, (&BatchRequest{}).Validate())
+}
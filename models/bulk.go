@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions of a bulk request
+const (
+	BulkComplete   = "complete"
+	BulkReopen     = "reopen"
+	BulkSetDueDate = "setDueDate"
+	BulkDelete     = "delete"
+	BulkAddTag     = "addTag"
+	BulkArchive    = "archive"
+)
+
+// BulkRequest is an action applied to every todo matching a filter
+type BulkRequest struct {
+	Action string `json:"action"`
+	// DueDate is set by setDueDate, null clears the due dates
+	DueDate *time.Time `json:"dueDate"`
+	// Tag is added by addTag
+	Tag string `json:"tag,omitempty"`
+	// DryRun returns the todos the action would apply to, without applying it
+	DryRun bool `json:"dryRun"`
+	// ConfirmationToken is returned by the dry run of a destructive action,
+	// and required to apply it
+	ConfirmationToken string `json:"confirmationToken,omitempty"`
+}
+
+// BulkResponse lists the todos a bulk action applies to
+type BulkResponse struct {
+	Action string      `json:"action"`
+	DryRun bool        `json:"dryRun"`
+	IDs    []uuid.UUID `json:"ids"`
+	// ConfirmationToken confirms the action of a dry run needing one, until ExpiresAt
+	ConfirmationToken string     `json:"confirmationToken,omitempty"`
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`
+	// Results are the results of the action on each todo, in the order of IDs
+	Results []BatchResult `json:"results,omitempty"`
+}
+
+// Destructive reports whether the action of b cannot be undone, deleting the todos
+// or overwriting their due dates, such actions need the confirmation token of a dry run
+func (b *BulkRequest) Destructive() bool {
+	return b.Action == BulkDelete || b.Action == BulkSetDueDate
+}
+
+// Validate returns a ValidationError listing every rule the request violates, or nil
+func (b *BulkRequest) Validate() error {
+	var v validator
+	switch b.Action {
+	case BulkComplete, BulkReopen, BulkDelete, BulkArchive:
+	case BulkSetDueDate:
+		v.dueDate("dueDate", b.DueDate, time.Now())
+	case BulkAddTag:
+		v.tag("tag", &b.Tag)
+	case "":
+		v.add("action", "is required")
+	default:
+		v.add("action", "must be one of %s, %s, %s, %s, %s, %s", BulkComplete, BulkReopen, BulkSetDueDate, BulkAddTag, BulkArchive, BulkDelete)
+	}
+	return v.err()
+}
@@ -0,0 +1,57 @@
+package models
+
+// Roles of the users a todo is shared with, each role includes the previous ones
+const (
+	// RoleViewer can read the todo
+	RoleViewer = "viewer"
+	// RoleEditor can also update the todo and its tasks
+	RoleEditor = "editor"
+	// RoleOwner can also delete the todo and share it
+	RoleOwner = "owner"
+)
+
+// Collaborator is a user a todo is shared with
+type Collaborator struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+}
+
+// ValidRole reports whether role is one of the roles
+func ValidRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// RoleAllows reports whether role includes required
+func RoleAllows(role, required string) bool {
+	return roleRank(role) > 0 && roleRank(role) >= roleRank(required)
+}
+
+// RoleOf returns the role of userID on t, the creator of t is its owner.
+// It returns an empty string when t is not shared with userID
+func (t Todo) RoleOf(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if t.OwnerID == userID {
+		return RoleOwner
+	}
+	for _, c := range t.Collaborators {
+		if c.UserID == userID {
+			return c.Role
+		}
+	}
+	return ""
+}
+
+func roleRank(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	}
+	return 0
+}
@@ -2,5 +2,10 @@ package models
 
 // CompletedTask flags the completed task
 type CompletedTask struct {
-	Completed bool
+	Completed bool `json:"completed"`
+}
+
+// Validate returns nil, every CompletedTask decoded is valid
+func (c *CompletedTask) Validate() error {
+	return nil
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -9,4 +11,38 @@ type Task struct {
 	ID        uuid.UUID `json:"id"`
 	Name      string    `json:"name"`
 	Completed bool      `json:"completed"`
+	// AssigneeID is the id of the user the task is assigned to, if any
+	AssigneeID string `json:"assigneeId,omitempty"`
+	// CompletedBy is the id of the user who completed the task
+	CompletedBy string `json:"completedBy,omitempty"`
+	// CompletedAt is when the task was completed
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// SetCompleted completes the task, recording who completed it and when,
+// or reopens it. Completing a completed task keeps the first completion
+func (t *Task) SetCompleted(completed bool, by string, at time.Time) {
+	switch {
+	case completed && !t.Completed:
+		t.CompletedBy = by
+		t.CompletedAt = &at
+	case !completed:
+		t.CompletedBy = ""
+		t.CompletedAt = nil
+	}
+	t.Completed = completed
+}
+
+// Validate trims the text fields of a task payload and returns a ValidationError
+// listing every rule it violates, or nil
+func (t *Task) Validate() error {
+	var v validator
+	t.validate(&v, "")
+	return v.err()
+}
+
+// validate records the violations of t, its fields prefixed with prefix
+func (t *Task) validate(v *validator, prefix string) {
+	v.text(prefix+"name", &t.Name, true, MaxNameLength)
+	v.text(prefix+"assigneeId", &t.AssigneeID, false, MaxNameLength)
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,4 +15,57 @@ type Todo struct {
 	Completed   bool       `json:"completed"`
 	DueDate     *time.Time `json:"dueDate"`
 	Tasks       []Task     `json:"tasks"`
+	// OwnerID is the id of the user who created the todo,
+	// todos created before owners existed have none
+	OwnerID string `json:"ownerId,omitempty"`
+	// Collaborators are the other users the todo is shared with
+	Collaborators []Collaborator `json:"collaborators,omitempty"`
+	// Tags label the todo, each tag at most once
+	Tags []string `json:"tags,omitempty"`
+	// Archived todos are kept but done with
+	Archived bool `json:"archived"`
+}
+
+// SchemaVersion is the version of the stored Todo records.
+// Version 2 added OwnerID, records of version 1 are read without owner.
+// Version 3 added Collaborators, version 4 the assignee and completion of tasks,
+// version 5 Tags and Archived
+const SchemaVersion = 5
+
+// Validate trims the text fields of a todo payload and returns a ValidationError
+// listing every rule it violates, or nil
+func (t *Todo) Validate() error {
+	var v validator
+	t.validate(&v, "")
+	return v.err()
+}
+
+// validate records the violations of t, its fields prefixed with prefix
+func (t *Todo) validate(v *validator, prefix string) {
+	v.text(prefix+"name", &t.Name, true, MaxNameLength)
+	v.text(prefix+"description", &t.Description, false, MaxDescriptionLength)
+	v.dueDate(prefix+"dueDate", t.DueDate, time.Now())
+	if len(t.Tags) > MaxTags {
+		v.add(prefix+"tags", "must be at most %d tags, not %d", MaxTags, len(t.Tags))
+	}
+	tags := make(map[string]bool)
+	for i := range t.Tags {
+		field := fmt.Sprintf("%stags[%d]", prefix, i)
+		v.tag(field, &t.Tags[i])
+		if tags[t.Tags[i]] {
+			v.add(field, "duplicates another tag")
+		}
+		tags[t.Tags[i]] = true
+	}
+	seen := make(map[uuid.UUID]bool)
+	for i := range t.Tasks {
+		field := fmt.Sprintf("%stasks[%d]", prefix, i)
+		t.Tasks[i].validate(v, field+".")
+		if id := t.Tasks[i].ID; id != uuid.Nil {
+			if seen[id] {
+				v.add(field+".id", "duplicates the id of another task")
+			}
+			seen[id] = true
+		}
+	}
 }
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTodo_Validate(t *testing.T) {
+	todo := Todo{Name: "  groceries ", Tasks: []Task{{Name: "milk"}}}
+	assert.Nil(t, todo.Validate())
+	assert.Equal(t, "groceries", todo.Name)
+
+	// every violation is reported with the path of its field
+	epoch := time.Unix(0, 0)
+	id := uuid.New()
+	todo = Todo{
+		Name:        " ",
+		Description: strings.Repeat("a", MaxDescriptionLength+1),
+		DueDate:     &epoch,
+		Tasks:       []Task{{ID: id, Name: "milk"}, {ID: id, Name: strings.Repeat("é", MaxNameLength+1)}},
+	}
+	err := todo.Validate()
+	var fields []string
+	for _, e := range err.(*ValidationError).Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.Equal(t, []string{"name", "description", "dueDate", "tasks[1].name", "tasks[1].id"}, fields)
+
+	todo = Todo{Name: "groceries", Tags: []string{" errands", "errands", strings.Repeat("a", MaxTagLength+1)}}
+	err = todo.Validate()
+	fields = nil
+	for _, e := range err.(*ValidationError).Errors {
+		fields = append(fields, e.Field)
+	}
+	assert.Equal(t, []string{"tags[1]", "tags[2]"}, fields)
+
+	farAway := time.Now().Add(2 * MaxDueDateAhead)
+	assert.NotNil(t, (&UpdatedTodo{DueDate: &farAway}).Validate())
+	assert.Nil(t, (&UpdatedTodo{}).Validate())
+}
@@ -7,3 +7,10 @@ type UpdatedTodo struct {
 	Completed bool       `json:"completed"`
 	DueDate   *time.Time `json:"dueDate"`
 }
+
+// Validate returns a ValidationError listing every rule the payload violates, or nil
+func (u *UpdatedTodo) Validate() error {
+	var v validator
+	v.dueDate("dueDate", u.DueDate, time.Now())
+	return v.err()
+}
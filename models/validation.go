@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of the fields of the payloads
+const (
+	// MaxNameLength is the length in characters of the name of a todo or a task
+	MaxNameLength = 200
+	// MaxDescriptionLength is the length in characters of the description of a todo
+	MaxDescriptionLength = 2000
+	// MaxTagLength is the length in characters of a tag
+	MaxTagLength = 50
+	// MaxTags is the number of tags of a todo
+	MaxTags = 20
+	// MaxDueDateAhead is how far in the future a due date may be
+	MaxDueDateAhead = 100 * 365 * 24 * time.Hour
+)
+
+// MinDueDate is the earliest due date allowed
+var MinDueDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FieldError is a rule violated by a field of a payload
+type FieldError struct {
+	// Field is the path of the field, such as tasks[1].name
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule violated by a payload
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error joins the violations
+func (v *ValidationError) Error() string {
+	var msgs []string
+	for _, e := range v.Errors {
+		msgs = append(msgs, e.Field+" "+e.Message)
+	}
+	return "invalid payload: " + strings.Join(msgs, "; ")
+}
+
+// validator collects the violations of a payload
+type validator struct {
+	errors []FieldError
+}
+
+// add records a violation of field
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// text trims the whitespace around s, and checks it is set when required and not longer than max
+func (v *validator) text(field string, s *string, required bool, max int) {
+	*s = strings.TrimSpace(*s)
+	if required && *s == "" {
+		v.add(field, "is required")
+	}
+	if n := utf8.RuneCountInString(*s); n > max {
+		v.add(field, "must be at most %d characters, not %d", max, n)
+	}
+}
+
+// tag trims the whitespace around s, and checks it is set and not longer than MaxTagLength
+func (v *validator) tag(field string, s *string) {
+	v.text(field, s, true, MaxTagLength)
+}
+
+// dueDate checks d is in the range of due dates
+func (v *validator) dueDate(field string, d *time.Time, now time.Time) {
+	if d == nil {
+		return
+	}
+	if d.Before(MinDueDate) {
+		v.add(field, "must not be before %s", MinDueDate.Format("2006-01-02"))
+	}
+	if max := now.Add(MaxDueDateAhead); d.After(max) {
+		v.add(field, "must not be after %s", max.Format("2006-01-02"))
+	}
+}
+
+// err returns the violations as a ValidationError, or nil
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
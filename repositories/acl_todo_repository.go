@@ -0,0 +1,242 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrForbidden is returned when the caller can see a todo but its role
+// on the todo does not allow the call
+var ErrForbidden = errors.New("forbidden")
+
+// ACL restricts every call to the todos the caller carried by the context of the call
+// owns or collaborates on, as allowed by its role:
+//   - a viewer reads the todo
+//   - an editor also updates the todo and adds, updates and deletes its tasks
+//   - an owner also deletes the todo and shares it
+//
+// Todos the caller has no role on are reported as not found, so their existence
+// is not disclosed. Calls without a caller, such as from the maintenance commands,
+// and callers granted auth.ScopeAdmin are not restricted
+func ACL() Middleware {
+	return func(repo TodoRepositoryV2) TodoRepositoryV2 {
+		return &aclTodoRepository{
+			repo: repo,
+		}
+	}
+}
+
+// aclTodoRepository implements ACL
+type aclTodoRepository struct {
+	repo TodoRepositoryV2
+}
+
+// caller returns the id of the caller the call is restricted to, if any
+func caller(ctx context.Context) (string, bool) {
+	p, ok := auth.FromContext(ctx)
+	if !ok || p.HasScope(auth.ScopeAdmin) {
+		return "", false
+	}
+	return p.UserID, true
+}
+
+// authorize returns the todo todoID, or an error unless the caller has the required role on it
+func (a *aclTodoRepository) authorize(ctx context.Context, todoID uuid.UUID, required string) (*models.Todo, error) {
+	todo, err := a.repo.GetTodoByID(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+	userID, ok := caller(ctx)
+	if !ok {
+		return todo, nil
+	}
+	role := todo.RoleOf(userID)
+	if role == "" {
+		return nil, notFound(todoID)
+	}
+	if !models.RoleAllows(role, required) {
+		return nil, errors.Wrapf(ErrForbidden, "%s of todo %s", role, todoID)
+	}
+	return todo, nil
+}
+
+// AddTodo adds new todo, owned by the caller
+func (a *aclTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	if userID, ok := caller(ctx); ok {
+		if todo.OwnerID != "" && todo.OwnerID != userID {
+			return errors.New("a todo cannot be added for another owner")
+		}
+		todo.OwnerID = userID
+	}
+	return a.repo.AddTodo(ctx, todo)
+}
+
+// AddTask adds task to existing todo
+func (a *aclTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	_, err := a.authorize(ctx, todoID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return a.repo.AddTask(ctx, todoID, task)
+}
+
+// GetTodo return list of todo
+func (a *aclTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	todoList, err := a.repo.GetTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, ok := caller(ctx)
+	if !ok {
+		return todoList, nil
+	}
+	var visible []models.Todo
+	for _, todo := range todoList {
+		if todo.RoleOf(userID) != "" {
+			visible = append(visible, todo)
+		}
+	}
+	return visible, nil
+}
+
+// IterateTodo iterates over todos
+func (a *aclTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	it, err := a.repo.IterateTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, ok := caller(ctx)
+	if !ok {
+		return it, nil
+	}
+	return &visibleTodoIterator{
+		TodoIterator: it,
+		userID:       userID,
+	}, nil
+}
+
+// GetTodoByID return todo by id
+func (a *aclTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	return a.authorize(ctx, todoID, models.RoleViewer)
+}
+
+// UpdateTodo updates todo
+func (a *aclTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	_, err := a.authorize(ctx, todoID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return a.repo.UpdateTodo(ctx, todoID, completed, dueDate)
+}
+
+// UpdateTask updates task for a specific todo
+func (a *aclTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	_, err := a.authorize(ctx, todoID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return a.repo.UpdateTask(ctx, todoID, taskID, completed, completedBy)
+}
+
+// DeleteTask deletes task
+func (a *aclTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	_, err := a.authorize(ctx, todoID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return a.repo.DeleteTask(ctx, todoID, taskID)
+}
+
+// DeleteTodo deletes todo
+func (a *aclTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	_, err := a.authorize(ctx, todoID, models.RoleOwner)
+	if err != nil {
+		return err
+	}
+	return a.repo.DeleteTodo(ctx, todoID)
+}
+
+// ShareTodo shares todo with a collaborator, only owners share a todo
+func (a *aclTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	if !models.ValidRole(collaborator.Role) {
+		return errors.Errorf("unknown role %q", collaborator.Role)
+	}
+	todo, err := a.authorize(ctx, todoID, models.RoleOwner)
+	if err != nil {
+		return err
+	}
+	if collaborator.UserID == "" || collaborator.UserID == todo.OwnerID {
+		return errors.New("a todo cannot be shared with its owner")
+	}
+	return a.repo.ShareTodo(ctx, todoID, collaborator)
+}
+
+// UnshareTodo stops sharing todo with a collaborator, only owners
+// unshare a todo but every collaborator can leave it
+func (a *aclTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	required := models.RoleOwner
+	if current, ok := caller(ctx); ok && current == userID {
+		required = models.RoleViewer
+	}
+	_, err := a.authorize(ctx, todoID, required)
+	if err != nil {
+		return err
+	}
+	return a.repo.UnshareTodo(ctx, todoID, userID)
+}
+
+// TagTodo adds tag to the tags of todo, for its editors
+func (a *aclTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	_, err := a.authorize(ctx, todoID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return a.repo.TagTodo(ctx, todoID, tag)
+}
+
+// ArchiveTodo archives or unarchives todo, for its editors
+func (a *aclTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	_, err := a.authorize(ctx, todoID, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return a.repo.ArchiveTodo(ctx, todoID, archived)
+}
+
+// Close implements io.Closer
+func (a *aclTodoRepository) Close() error {
+	return closeRepo(a.repo)
+}
+
+// Transact runs fn in a transaction of the wrapped repository, restricted like the repository
+func (a *aclTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	return Transact(ctx, a.repo, func(tx TodoRepositoryV2) error {
+		return fn(&aclTodoRepository{repo: tx})
+	})
+}
+
+// CorruptRecords implements CorruptRecordReporter
+func (a *aclTodoRepository) CorruptRecords(ctx context.Context) []string {
+	return corruptRecords(ctx, a.repo)
+}
+
+// visibleTodoIterator skips the todos the user has no role on
+type visibleTodoIterator struct {
+	TodoIterator
+	userID string
+}
+
+// Next advances to the next todo the user has a role on
+func (v *visibleTodoIterator) Next() bool {
+	for v.TodoIterator.Next() {
+		if v.Todo().RoleOf(v.userID) != "" {
+			return true
+		}
+	}
+	return false
+}
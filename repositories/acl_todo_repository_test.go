@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/elumbantoruan/todo/auth"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACL(t *testing.T) {
+	repo := Chain(NewMemoryTodoRepository(), ACL())
+	alice := auth.NewContext(context.Background(), auth.Principal{UserID: "alice", Scopes: []string{auth.ScopeTodoWrite}})
+	bob := auth.NewContext(context.Background(), auth.Principal{UserID: "bob", Scopes: []string{auth.ScopeTodoWrite}})
+	admin := auth.NewContext(context.Background(), auth.Principal{UserID: "root", Scopes: []string{auth.ScopeAdmin}})
+
+	todo := newTodo()
+	assert.Nil(t, repo.AddTodo(alice, todo))
+	assert.Nil(t, repo.AddTodo(bob, newTodo()))
+
+	list, _ := repo.GetTodo(alice)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "alice", list[0].OwnerID)
+
+	it, _ := repo.IterateTodo(bob)
+	n := 0
+	for it.Next() {
+		assert.Equal(t, "bob", it.Todo().OwnerID)
+		n++
+	}
+	it.Close()
+	assert.Equal(t, 1, n)
+
+	// the todos of others are not found
+	_, err := repo.GetTodoByID(bob, todo.ID)
+	assert.True(t, strings.Contains(err.Error(), "no such file"))
+	err = repo.DeleteTodo(bob, todo.ID)
+	assert.True(t, strings.Contains(err.Error(), "no such file"))
+
+	// admins and calls without caller are not restricted
+	list, _ = repo.GetTodo(admin)
+	assert.Equal(t, 2, len(list))
+	list, _ = repo.GetTodo(context.Background())
+	assert.Equal(t, 2, len(list))
+	assert.Nil(t, repo.DeleteTodo(alice, todo.ID))
+}
+
+func TestACL_Roles(t *testing.T) {
+	repo := Chain(NewMemoryTodoRepository(), ACL())
+	alice := auth.NewContext(context.Background(), auth.Principal{UserID: "alice", Scopes: []string{auth.ScopeTodoWrite}})
+	bob := auth.NewContext(context.Background(), auth.Principal{UserID: "bob", Scopes: []string{auth.ScopeTodoWrite}})
+
+	todo := newTodo()
+	assert.Nil(t, repo.AddTodo(alice, todo))
+
+	// only owners share
+	err := repo.ShareTodo(bob, todo.ID, models.Collaborator{UserID: "bob", Role: models.RoleOwner})
+	assert.True(t, strings.Contains(err.Error(), "no such file"))
+	err = repo.ShareTodo(alice, todo.ID, models.Collaborator{UserID: "bob", Role: "admin"})
+	assert.NotNil(t, err)
+	err = repo.ShareTodo(alice, todo.ID, models.Collaborator{UserID: "alice", Role: models.RoleViewer})
+	assert.NotNil(t, err)
+	assert.Nil(t, repo.ShareTodo(alice, todo.ID, models.Collaborator{UserID: "bob", Name: "bob", Role: models.RoleViewer}))
+
+	// a viewer reads the todo but cannot change it
+	shared, err := repo.GetTodoByID(bob, todo.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, models.RoleViewer, shared.RoleOf("bob"))
+	list, _ := repo.GetTodo(bob)
+	assert.Equal(t, 1, len(list))
+	err = repo.UpdateTodo(bob, todo.ID, true, nil)
+	assert.Equal(t, ErrForbidden, errors.Cause(err))
+	err = repo.UpdateTask(bob, todo.ID, todo.Tasks[0].ID, true, "bob")
+	assert.Equal(t, ErrForbidden, errors.Cause(err))
+	err = repo.AddTask(bob, todo.ID, models.Task{ID: uuid.New()})
+	assert.Equal(t, ErrForbidden, errors.Cause(err))
+
+	// an editor changes the todo and its tasks, but cannot delete nor share it
+	assert.Nil(t, repo.ShareTodo(alice, todo.ID, models.Collaborator{UserID: "bob", Name: "bob", Role: models.RoleEditor}))
+	shared, _ = repo.GetTodoByID(alice, todo.ID)
+	assert.Equal(t, 1, len(shared.Collaborators))
+	assert.Nil(t, repo.UpdateTask(bob, todo.ID, todo.Tasks[0].ID, true, "bob"))
+	assert.Nil(t, repo.UpdateTodo(bob, todo.ID, true, nil))
+	err = repo.DeleteTodo(bob, todo.ID)
+	assert.Equal(t, ErrForbidden, errors.Cause(err))
+	err = repo.ShareTodo(bob, todo.ID, models.Collaborator{UserID: "carol", Role: models.RoleViewer})
+	assert.Equal(t, ErrForbidden, errors.Cause(err))
+
+	// collaborators leave a todo, then it is not found anymore
+	assert.Nil(t, repo.UnshareTodo(bob, todo.ID, "bob"))
+	_, err = repo.GetTodoByID(bob, todo.ID)
+	assert.True(t, strings.Contains(err.Error(), "no such file"))
+}
@@ -0,0 +1,340 @@
+package repositories
+
+import (
+	containerlist "container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+)
+
+// CacheStats reports the activity of a CachedTodoRepository
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+// CachedTodoRepository is a write-through LRU cache of decoded todos
+// in front of any TodoRepositoryV2.
+// Every mutation goes to the wrapped repository first and then
+// invalidates the cached entries it affects
+type CachedTodoRepository struct {
+	repo       TodoRepositoryV2
+	maxEntries int
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	lru   *containerlist.List
+	items map[uuid.UUID]*containerlist.Element
+	all   *cacheEntry
+	stats CacheStats
+	// gen changes on every mutation, so a value read from the wrapped
+	// repository while a mutation was in flight is not cached
+	gen uint64
+}
+
+// cacheEntry is a cached todo, or the cached result of GetTodo
+type cacheEntry struct {
+	id      uuid.UUID
+	todo    models.Todo
+	list    []models.Todo
+	expires time.Time
+}
+
+// NewCachedTodoRepository creates an instance of CachedTodoRepository
+// holding up to maxEntries todos for ttl. A zero ttl never expires entries
+func NewCachedTodoRepository(repo TodoRepositoryV2, maxEntries int, ttl time.Duration) *CachedTodoRepository {
+	return &CachedTodoRepository{
+		repo:       repo,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        containerlist.New(),
+		items:      make(map[uuid.UUID]*containerlist.Element),
+	}
+}
+
+// AddTodo adds new todo, and caches it once stored
+func (c *CachedTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	err := c.repo.AddTodo(ctx, todo)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.all = nil
+	c.gen++
+	if err != nil {
+		c.remove(todo.ID)
+		return err
+	}
+	c.put(todo)
+	return nil
+}
+
+// AddTask adds task to existing todo
+func (c *CachedTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	err := c.repo.AddTask(ctx, todoID, task)
+	c.invalidate(todoID)
+	return err
+}
+
+// GetTodo return list of todo
+// The list is cached unless it holds more todos than the entries of the cache
+func (c *CachedTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	c.mu.Lock()
+	if c.all != nil && !c.expired(c.all) {
+		c.stats.Hits++
+		todoList := cloneTodoList(c.all.list)
+		c.mu.Unlock()
+		return todoList, nil
+	}
+	c.stats.Misses++
+	gen := c.gen
+	c.mu.Unlock()
+
+	todoList, err := c.repo.GetTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// a list is cached while it fits in the entries of the cache
+	if gen == c.gen && len(todoList) <= c.maxEntries {
+		c.all = &cacheEntry{
+			list:    cloneTodoList(todoList),
+			expires: c.expiry(),
+		}
+	}
+	c.mu.Unlock()
+	return todoList, nil
+}
+
+// IterateTodo iterates over todos of the wrapped repository
+// Iterations are meant for large exports, so they bypass the cache
+func (c *CachedTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	return c.repo.IterateTodo(ctx)
+}
+
+// GetTodoByID return todo by id
+func (c *CachedTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	c.mu.Lock()
+	if e, ok := c.items[todoID]; ok {
+		entry := e.Value.(*cacheEntry)
+		if !c.expired(entry) {
+			c.stats.Hits++
+			c.lru.MoveToFront(e)
+			todo := cloneTodo(entry.todo)
+			c.mu.Unlock()
+			return &todo, nil
+		}
+		c.remove(todoID)
+	}
+	c.stats.Misses++
+	gen := c.gen
+	c.mu.Unlock()
+
+	todo, err := c.repo.GetTodoByID(ctx, todoID)
+	if err != nil || todo == nil {
+		return todo, err
+	}
+
+	c.mu.Lock()
+	if gen == c.gen {
+		c.put(*todo)
+	}
+	c.mu.Unlock()
+	return todo, nil
+}
+
+// UpdateTodo updates todo
+func (c *CachedTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	err := c.repo.UpdateTodo(ctx, todoID, completed, dueDate)
+	c.invalidate(todoID)
+	return err
+}
+
+// UpdateTask updates task for a specific todo
+func (c *CachedTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	err := c.repo.UpdateTask(ctx, todoID, taskID, completed, completedBy)
+	c.invalidate(todoID)
+	return err
+}
+
+// DeleteTask deletes task
+func (c *CachedTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	err := c.repo.DeleteTask(ctx, todoID, taskID)
+	c.invalidate(todoID)
+	return err
+}
+
+// DeleteTodo deletes todo
+func (c *CachedTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	err := c.repo.DeleteTodo(ctx, todoID)
+	c.invalidate(todoID)
+	return err
+}
+
+// Close implements io.Closer
+func (c *CachedTodoRepository) Close() error {
+	return closeRepo(c.repo)
+}
+
+// ShareTodo shares todo with a collaborator
+func (c *CachedTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	err := c.repo.ShareTodo(ctx, todoID, collaborator)
+	c.invalidate(todoID)
+	return err
+}
+
+// UnshareTodo stops sharing todo with a collaborator
+func (c *CachedTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	err := c.repo.UnshareTodo(ctx, todoID, userID)
+	c.invalidate(todoID)
+	return err
+}
+
+// TagTodo adds tag to the tags of todo
+func (c *CachedTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	err := c.repo.TagTodo(ctx, todoID, tag)
+	c.invalidate(todoID)
+	return err
+}
+
+// ArchiveTodo archives or unarchives todo
+func (c *CachedTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	err := c.repo.ArchiveTodo(ctx, todoID, archived)
+	c.invalidate(todoID)
+	return err
+}
+
+// Transact runs fn in a transaction of the wrapped repository, bypassing the cache.
+// The cache is purged once the transaction ends
+func (c *CachedTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	err := Transact(ctx, c.repo, fn)
+	c.Purge()
+	return err
+}
+
+// CorruptRecords implements CorruptRecordReporter
+func (c *CachedTodoRepository) CorruptRecords(ctx context.Context) []string {
+	return corruptRecords(ctx, c.repo)
+}
+
+// Stats returns the hit, miss and eviction counters of the cache
+func (c *CachedTodoRepository) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Purge drops every cached entry
+func (c *CachedTodoRepository) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.items = make(map[uuid.UUID]*containerlist.Element)
+	c.all = nil
+	c.gen++
+}
+
+// invalidate drops the cached todo and the cached list
+func (c *CachedTodoRepository) invalidate(todoID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(todoID)
+	c.all = nil
+	c.gen++
+}
+
+// put caches a copy of todo, evicting the least recently used entry when full.
+// The caller holds mu
+func (c *CachedTodoRepository) put(todo models.Todo) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	entry := &cacheEntry{
+		id:      todo.ID,
+		todo:    cloneTodo(todo),
+		expires: c.expiry(),
+	}
+	if e, ok := c.items[todo.ID]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.items[todo.ID] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).id)
+		c.stats.Evictions++
+	}
+}
+
+// remove drops the cached todo. The caller holds mu
+func (c *CachedTodoRepository) remove(todoID uuid.UUID) {
+	if e, ok := c.items[todoID]; ok {
+		c.lru.Remove(e)
+		delete(c.items, todoID)
+	}
+}
+
+func (c *CachedTodoRepository) expiry() time.Time {
+	if c.ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.ttl)
+}
+
+func (c *CachedTodoRepository) expired(entry *cacheEntry) bool {
+	return !entry.expires.IsZero() && time.Now().After(entry.expires)
+}
+
+// cloneTodo returns a deep copy of todo, so callers cannot modify cached values
+func cloneTodo(todo models.Todo) models.Todo {
+	if todo.DueDate != nil {
+		dueDate := *todo.DueDate
+		todo.DueDate = &dueDate
+	}
+	if todo.Tasks != nil {
+		tasks := make([]models.Task, len(todo.Tasks))
+		copy(tasks, todo.Tasks)
+		for i := range tasks {
+			if tasks[i].CompletedAt != nil {
+				completedAt := *tasks[i].CompletedAt
+				tasks[i].CompletedAt = &completedAt
+			}
+		}
+		todo.Tasks = tasks
+	}
+	if todo.Collaborators != nil {
+		collaborators := make([]models.Collaborator, len(todo.Collaborators))
+		copy(collaborators, todo.Collaborators)
+		todo.Collaborators = collaborators
+	}
+	if todo.Tags != nil {
+		tags := make([]string, len(todo.Tags))
+		copy(tags, todo.Tags)
+		todo.Tags = tags
+	}
+	return todo
+}
+
+func cloneTodoList(todoList []models.Todo) []models.Todo {
+	if todoList == nil {
+		return nil
+	}
+	clone := make([]models.Todo, len(todoList))
+	for i, todo := range todoList {
+		clone[i] = cloneTodo(todo)
+	}
+	return clone
+}
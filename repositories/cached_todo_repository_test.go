@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedTodoRepository_GetTodoByID(t *testing.T) {
+	mockRepo := MockTodoRepository{}
+	mockRepo.Clear()
+	ctx := context.Background()
+
+	todo := newTodo()
+	mockRepo.AddTodo(todo)
+
+	cache := NewCachedTodoRepository(NewTodoRepositoryAdapter(mockRepo), 10, time.Minute)
+	cache.GetTodoByID(ctx, todo.ID)
+	val, err := cache.GetTodoByID(ctx, todo.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, todo.ID, val.ID)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Entries: 1}, cache.Stats())
+
+	// modifying the returned value does not modify the cached one
+	val.Tasks[0].Completed = true
+	val, _ = cache.GetTodoByID(ctx, todo.ID)
+	assert.False(t, val.Tasks[0].Completed)
+
+	// a mutation invalidates the entry
+	cache.UpdateTask(ctx, todo.ID, todo.Tasks[0].ID, true, "")
+	val, _ = cache.GetTodoByID(ctx, todo.ID)
+	assert.True(t, val.Tasks[0].Completed)
+	assert.Equal(t, uint64(2), cache.Stats().Misses)
+}
+
+func TestCachedTodoRepository_GetTodoByID_CompletedAt(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCachedTodoRepository(NewMemoryTodoRepository(), 10, time.Minute)
+	todo := newTodo()
+	completedAt := time.Now().UTC()
+	at := completedAt
+	todo.Tasks[0].Completed, todo.Tasks[0].CompletedAt = true, &at
+	cache.AddTodo(ctx, todo)
+
+	// modifying the time a cached task was completed does not modify the cached one
+	cache.GetTodoByID(ctx, todo.ID)
+	val, _ := cache.GetTodoByID(ctx, todo.ID)
+	*val.Tasks[0].CompletedAt = completedAt.Add(time.Hour)
+	val, _ = cache.GetTodoByID(ctx, todo.ID)
+	assert.Equal(t, completedAt, *val.Tasks[0].CompletedAt)
+}
+
+func TestCachedTodoRepository_Eviction(t *testing.T) {
+	mockRepo := MockTodoRepository{}
+	mockRepo.Clear()
+	ctx := context.Background()
+
+	cache := NewCachedTodoRepository(NewTodoRepositoryAdapter(mockRepo), 2, 0)
+	for i := 0; i < 3; i++ {
+		cache.AddTodo(ctx, newTodo())
+	}
+	stats := cache.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	// the cached list is dropped when a todo is added
+	list, _ := cache.GetTodo(ctx)
+	assert.Equal(t, 3, len(list))
+	cache.AddTodo(ctx, newTodo())
+	list, _ = cache.GetTodo(ctx)
+	assert.Equal(t, 4, len(list))
+}
+
+func TestCachedTodoRepository_GetTodo(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCachedTodoRepository(NewMemoryTodoRepository(), 2, 0)
+
+	cache.AddTodo(ctx, newTodo())
+	cache.AddTodo(ctx, newTodo())
+	cache.GetTodo(ctx)
+	list, _ := cache.GetTodo(ctx)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Entries: 2}, cache.Stats())
+
+	// a list larger than the cache is not cached
+	cache.AddTodo(ctx, newTodo())
+	cache.GetTodo(ctx)
+	list, _ = cache.GetTodo(ctx)
+	assert.Equal(t, 3, len(list))
+	assert.Equal(t, uint64(1), cache.Stats().Hits)
+	assert.Equal(t, uint64(3), cache.Stats().Misses)
+}
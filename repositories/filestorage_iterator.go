@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/pkg/errors"
+)
+
+// fileStorageTodoIterator reads one record at a time while walking the keys of the records
+type fileStorageTodoIterator struct {
+	f      *FileStorageTodoRepository
+	ctx    context.Context
+	cancel chan struct{}
+	keys   <-chan string
+	todo   models.Todo
+	err    error
+	closed bool
+	// corrupt holds the keys of the records skipped so far,
+	// they are reported once the walk is complete
+	corrupt map[string]bool
+	done    bool
+}
+
+// IterateTodo iterates over every todo reading one record at a time,
+// so memory does not grow with the number of todos.
+// Unlike GetTodo, the read lock is only held while reading each record,
+// so a slow consumer does not block writers; each todo is consistent but
+// the iteration is not a snapshot. Corrupt records are skipped, and reported
+// by CorruptRecords once the iteration is complete, as they are by GetTodo
+func (f *FileStorageTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cancel := make(chan struct{})
+	return &fileStorageTodoIterator{
+		f:       f,
+		ctx:     ctx,
+		cancel:  cancel,
+		keys:    f.keys(cancel),
+		corrupt: make(map[string]bool),
+	}, nil
+}
+
+// Next advances to the next todo
+func (i *fileStorageTodoIterator) Next() bool {
+	if i.err != nil || i.closed || i.done {
+		return false
+	}
+	for key := range i.keys {
+		if err := i.ctx.Err(); err != nil {
+			i.err = errors.WithStack(err)
+			return false
+		}
+
+		i.f.mu.RLock()
+		value, err := i.f.disk.Read(key)
+		i.f.mu.RUnlock()
+		if os.IsNotExist(err) {
+			// deleted since the walk listed it
+			continue
+		}
+		if err == nil {
+			i.todo, err = i.f.decode(value)
+		}
+		if err != nil {
+			slog.Warn("skipping corrupt todo record", "key", key, "error", err)
+			i.corrupt[key] = true
+			continue
+		}
+		return true
+	}
+	i.done = true
+	i.report()
+	return false
+}
+
+// report replaces the corrupt records of the repository with those of the complete walk.
+// The walk is not a snapshot, so the records skipped are read again while writes wait,
+// those rewritten or erased since are not corrupt anymore
+func (i *fileStorageTodoIterator) report() {
+	i.f.mu.RLock()
+	defer i.f.mu.RUnlock()
+
+	for key := range i.corrupt {
+		value, err := i.f.disk.Read(key)
+		if os.IsNotExist(err) {
+			delete(i.corrupt, key)
+			continue
+		}
+		if err == nil {
+			_, err = i.f.decode(value)
+		}
+		if err == nil {
+			delete(i.corrupt, key)
+		}
+	}
+
+	i.f.corruptMu.Lock()
+	i.f.corrupt = i.corrupt
+	i.f.corruptMu.Unlock()
+}
+
+// Todo returns the current todo
+func (i *fileStorageTodoIterator) Todo() models.Todo {
+	return i.todo
+}
+
+// Err returns the error which stopped the iteration
+func (i *fileStorageTodoIterator) Err() error {
+	return i.err
+}
+
+// Close stops the walk of the keys
+func (i *fileStorageTodoIterator) Close() error {
+	if !i.closed {
+		i.closed = true
+		close(i.cancel)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorageTodoRepository_IterateTodo_SkipsCorrupt(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	repo := NewFileStorageTodoRepository(dir)
+	todo := newTodo()
+	repo.AddTodo(ctx, todo)
+	corruptKey := uuid.New().String()
+	ioutil.WriteFile(filepath.Join(dir, corruptKey), []byte("not a gob"), 0644)
+
+	// an iteration cut short reports nothing
+	it, err := repo.IterateTodo(ctx)
+	assert.Nil(t, err)
+	it.Close()
+	assert.Empty(t, repo.CorruptRecords(ctx))
+
+	it, err = repo.IterateTodo(ctx)
+	assert.Nil(t, err)
+	var ids []uuid.UUID
+	for it.Next() {
+		ids = append(ids, it.Todo().ID)
+	}
+	assert.Nil(t, it.Err())
+	it.Close()
+	assert.Equal(t, []uuid.UUID{todo.ID}, ids)
+	assert.Equal(t, []string{corruptKey}, repo.CorruptRecords(ctx))
+
+	// a record erased during the iteration is not reported
+	it, _ = repo.IterateTodo(ctx)
+	for it.Next() {
+		assert.Nil(t, repo.DeleteTodo(ctx, uuid.MustParse(corruptKey)))
+	}
+	it.Close()
+	assert.Empty(t, repo.CorruptRecords(ctx))
+}
@@ -2,9 +2,17 @@ package repositories
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/elumbantoruan/todo/encryption"
 	"github.com/elumbantoruan/todo/models"
 	"github.com/google/uuid"
 	"github.com/peterbourgon/diskv"
@@ -14,61 +22,101 @@ import (
 // FileStorageTodoRepository represent a concerete implementation
 // of TodoRepository
 type FileStorageTodoRepository struct {
-	disk *diskv.Diskv
+	// mu serializes writers against readers so a reader never
+	// observes a partially written record
+	mu      sync.RWMutex
+	disk    *diskv.Diskv
+	keyring *encryption.Keyring
+	// closed rejects writes once Close returned
+	closed bool
+	// lock holds the lock taken by Lock on the folder
+	lock io.Closer
+
+	// corrupt holds the keys skipped by the latest complete scan,
+	// a key leaves it once its record is rewritten or erased
+	corruptMu sync.Mutex
+	corrupt   map[string]bool
+}
+
+// ErrClosed is returned by writes to a closed repository
+var ErrClosed = errors.New("repository closed")
+
+// ErrLocked is returned by Lock when another process locked the folder
+var ErrLocked = errors.New("data directory is locked by another process")
+
+// FileStorageOptions configures a FileStorageTodoRepository
+type FileStorageOptions struct {
+	// Path is the folder storing one file per todo
+	Path string
+	// CacheSizeMax is the size in bytes of the in-memory cache of raw records
+	CacheSizeMax uint64
+	// Keyring encrypts records at rest when set.
+	// Plaintext records written before encryption was enabled are then
+	// reported as corrupt, until Reencrypt encrypts them
+	Keyring *encryption.Keyring
 }
 
 // NewFileStorageTodoRepository creates an instance of
 // FileStorageTodoRepository
 func NewFileStorageTodoRepository(path string) *FileStorageTodoRepository {
+	return NewFileStorageTodoRepositoryWithOptions(FileStorageOptions{
+		Path:         path,
+		CacheSizeMax: 1024 * 1024,
+	})
+}
+
+// NewFileStorageTodoRepositoryWithOptions creates an instance of
+// FileStorageTodoRepository configured by opts
+func NewFileStorageTodoRepositoryWithOptions(opts FileStorageOptions) *FileStorageTodoRepository {
 	flatTransform := func(s string) []string { return []string{} }
 
 	d := diskv.New(diskv.Options{
-		BasePath:     path,
+		BasePath:     opts.Path,
 		Transform:    flatTransform,
-		CacheSizeMax: 1024 * 1024,
+		CacheSizeMax: opts.CacheSizeMax,
 	})
 	return &FileStorageTodoRepository{
-		disk: d,
+		disk:    d,
+		keyring: opts.Keyring,
 	}
 }
 
 // AddTodo adds new todo
 // The record is stored in the disk folder defines in path
-func (f *FileStorageTodoRepository) AddTodo(todo models.Todo) error {
+func (f *FileStorageTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	// check for dups
-	var cancel = make(chan struct{})
-	keys := f.disk.Keys(cancel)
-	for key := range keys {
-		if key == todo.ID.String() {
-			return errors.New("duplicate todoID")
-		}
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
 	}
 
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	enc.Encode(todo)
-
-	err := f.disk.Write(todo.ID.String(), buffer.Bytes())
-	if err != nil {
-		err = errors.WithStack(err)
+	// check for dups
+	if f.disk.Has(todo.ID.String()) {
+		return errors.New("duplicate todoID")
 	}
-	return err
+
+	return f.write(todo)
 }
 
 // AddTask adds task to existing todo
 // First, it needs to fetch existing todo, deserialize it, and append new task
 // to list of task
-func (f *FileStorageTodoRepository) AddTask(todoID uuid.UUID, task models.Task) error {
+func (f *FileStorageTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	value, _ := f.disk.Read(todoID.String())
 	var (
 		todo models.Todo
 		err  error
 	)
 
-	dec := gob.NewDecoder(bytes.NewReader(value))
-
-	err = dec.Decode(&todo)
+	todo, err = f.decode(value)
 	if err != nil {
 		err = errors.WithStack(err)
 		return err
@@ -83,59 +131,137 @@ func (f *FileStorageTodoRepository) AddTask(todoID uuid.UUID, task models.Task)
 
 	todo.Tasks = append(todo.Tasks, task)
 
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	err = enc.Encode(todo)
-	if err != nil {
-		err = errors.WithStack(err)
-		return err
-	}
-
-	err = f.disk.Write(todo.ID.String(), buffer.Bytes())
-	if err != nil {
-		err = errors.WithStack(err)
-	}
-	return err
+	return f.write(todo)
 }
 
 // GetTodo return list of todo
-func (f *FileStorageTodoRepository) GetTodo() ([]models.Todo, error) {
+// The whole scan holds the read lock, so the list is a consistent snapshot.
+// Records which cannot be read or decoded are skipped and reported
+// through CorruptRecords instead of failing the whole list.
+// The scan stops as soon as ctx is done
+func (f *FileStorageTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.list(ctx)
+}
+
+// list reads every record. The caller holds mu
+func (f *FileStorageTodoRepository) list(ctx context.Context) ([]models.Todo, error) {
 	var (
 		cancel   = make(chan struct{})
 		todoList []models.Todo
+		corrupt  = make(map[string]bool)
 	)
+	// closing cancel stops the walk of the keys when returning early
+	defer close(cancel)
 
-	keys := f.disk.Keys(cancel)
+	keys := f.keys(cancel)
 	for key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
 		var todo models.Todo
-		value, _ := f.disk.Read(key)
-		dec := gob.NewDecoder(bytes.NewReader(value))
-		err := dec.Decode(&todo)
+		value, err := f.disk.Read(key)
+		if err == nil {
+			todo, err = f.decode(value)
+		}
 		if err != nil {
-			err = errors.WithStack(err)
-			return nil, err
+			slog.Warn("skipping corrupt todo record", "key", key, "error", err)
+			corrupt[key] = true
+			continue
 		}
 		todoList = append(todoList, todo)
 	}
+
+	f.corruptMu.Lock()
+	f.corrupt = corrupt
+	f.corruptMu.Unlock()
+
 	return todoList, nil
 }
 
+// CorruptRecords returns the sorted keys of the records skipped by the latest
+// complete scan, but those rewritten or erased since
+func (f *FileStorageTodoRepository) CorruptRecords(ctx context.Context) []string {
+	f.corruptMu.Lock()
+	defer f.corruptMu.Unlock()
+
+	var corrupt []string
+	for key := range f.corrupt {
+		corrupt = append(corrupt, key)
+	}
+	sort.Strings(corrupt)
+	return corrupt
+}
+
+// repaired removes keys from the corrupt records, once their records are rewritten or erased
+func (f *FileStorageTodoRepository) repaired(keys ...string) {
+	f.corruptMu.Lock()
+	defer f.corruptMu.Unlock()
+
+	for _, key := range keys {
+		delete(f.corrupt, key)
+	}
+}
+
+// keys walks the keys of the records, which are the regular files directly in the folder:
+// subdirectories, such as the folders of the tenants, are not walked, and dot-files,
+// such as the probes of the readiness check, are not records.
+// The walk stops once cancel is closed
+func (f *FileStorageTodoRepository) keys(cancel <-chan struct{}) <-chan string {
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		dir, err := os.Open(f.disk.BasePath)
+		if err != nil {
+			return
+		}
+		defer dir.Close()
+		for {
+			entries, err := dir.ReadDir(256)
+			for _, entry := range entries {
+				if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+					continue
+				}
+				select {
+				case keys <- entry.Name():
+				case <-cancel:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
+
 // GetTodoByID return todo by id
-func (f *FileStorageTodoRepository) GetTodoByID(todoID uuid.UUID) (*models.Todo, error) {
+func (f *FileStorageTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.getTodoByID(ctx, todoID)
+}
+
+func (f *FileStorageTodoRepository) getTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
 	var (
 		todo models.Todo
 		err  error
 		bts  []byte
 	)
+	if err = ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
 	bts, err = f.disk.Read(todoID.String())
 	if err != nil {
 		err = errors.WithStack(err)
 		return nil, err
 	}
 
-	dec := gob.NewDecoder(bytes.NewReader(bts))
-
-	err = dec.Decode(&todo)
+	todo, err = f.decode(bts)
 	if err != nil {
 		err = errors.WithStack(err)
 		return nil, err
@@ -144,8 +270,11 @@ func (f *FileStorageTodoRepository) GetTodoByID(todoID uuid.UUID) (*models.Todo,
 }
 
 // UpdateTodo updates todo
-func (f *FileStorageTodoRepository) UpdateTodo(todoID uuid.UUID, completed bool, dueDate *time.Time) error {
-	todo, err := f.GetTodoByID(todoID)
+func (f *FileStorageTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	todo, err := f.getTodoByID(ctx, todoID)
 	if err != nil {
 		err = errors.WithStack(err)
 		return err
@@ -153,68 +282,54 @@ func (f *FileStorageTodoRepository) UpdateTodo(todoID uuid.UUID, completed bool,
 	todo.Completed = completed
 	todo.DueDate = dueDate
 
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	err = enc.Encode(todo)
-	if err != nil {
-		err = errors.WithStack(err)
-		return err
-	}
-
-	err = f.disk.Write(todo.ID.String(), buffer.Bytes())
-	if err != nil {
-		err = errors.WithStack(err)
-	}
-	return err
+	return f.write(*todo)
 }
 
 // UpdateTask updates task for a specific todo
-func (f *FileStorageTodoRepository) UpdateTask(todoID uuid.UUID, taskID uuid.UUID, completed bool) error {
+func (f *FileStorageTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	value, _ := f.disk.Read(todoID.String())
 	var (
 		todo models.Todo
 		err  error
 	)
 
-	dec := gob.NewDecoder(bytes.NewReader(value))
-
-	err = dec.Decode(&todo)
+	todo, err = f.decode(value)
 	if err != nil {
 		err = errors.WithStack(err)
 		return err
 	}
 	for i := 0; i < len(todo.Tasks); i++ {
 		if todo.Tasks[i].ID == taskID {
-			todo.Tasks[i].Completed = completed
+			todo.Tasks[i].SetCompleted(completed, completedBy, time.Now().UTC())
 			break
 		}
 	}
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	err = enc.Encode(todo)
-	if err != nil {
-		err = errors.WithStack(err)
-		return err
-	}
-
-	err = f.disk.Write(todo.ID.String(), buffer.Bytes())
-	if err != nil {
-		err = errors.WithStack(err)
-	}
-	return err
+	return f.write(todo)
 }
 
 // DeleteTask deletes task
-func (f *FileStorageTodoRepository) DeleteTask(todoID, taskID uuid.UUID) error {
+func (f *FileStorageTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	value, _ := f.disk.Read(todoID.String())
 	var (
 		todo models.Todo
 		err  error
 	)
 
-	dec := gob.NewDecoder(bytes.NewReader(value))
-
-	err = dec.Decode(&todo)
+	todo, err = f.decode(value)
 	if err != nil {
 		err = errors.WithStack(err)
 		return err
@@ -231,27 +346,332 @@ func (f *FileStorageTodoRepository) DeleteTask(todoID, taskID uuid.UUID) error {
 			break
 		}
 	}
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	err = enc.Encode(todo)
+	return f.write(todo)
+}
+
+// DeleteTodo deletes todo
+func (f *FileStorageTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if f.closed {
+		return errors.WithStack(ErrClosed)
+	}
+	err := f.disk.Erase(todoID.String())
 	if err != nil {
 		err = errors.WithStack(err)
 		return err
 	}
+	f.repaired(todoID.String())
+	return nil
+}
+
+// ShareTodo shares todo with a collaborator, or changes its role when already shared
+func (f *FileStorageTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	err = f.disk.Write(todo.ID.String(), buffer.Bytes())
+	todo, err := f.getTodoByID(ctx, todoID)
 	if err != nil {
-		err = errors.WithStack(err)
+		return err
+	}
+	todo.Collaborators = share(todo.Collaborators, collaborator)
+	return f.write(*todo)
+}
+
+// UnshareTodo stops sharing todo with the collaborator userID
+func (f *FileStorageTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	todo, err := f.getTodoByID(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todo.Collaborators = unshare(todo.Collaborators, userID)
+	return f.write(*todo)
+}
+
+// TagTodo adds tag to the tags of todo
+func (f *FileStorageTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	todo, err := f.getTodoByID(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	err = addTag(todo, tag)
+	if err != nil {
+		return err
+	}
+	return f.write(*todo)
+}
+
+// ArchiveTodo archives or unarchives todo
+func (f *FileStorageTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	todo, err := f.getTodoByID(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todo.Archived = archived
+	return f.write(*todo)
+}
+
+// Transact calls fn with a transaction over the records, see Transactor.
+// The writes are staged in memory and written once fn returns, writers
+// wait for the transaction to end. When writing a record fails,
+// the records written before it are restored
+func (f *FileStorageTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if f.closed {
+		return errors.WithStack(ErrClosed)
+	}
+	return transact(ctx, f, fn)
+}
+
+// load reads the record todoID. The caller holds mu
+func (f *FileStorageTodoRepository) load(ctx context.Context, todoID uuid.UUID) (models.Todo, error) {
+	todo, err := f.getTodoByID(ctx, todoID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return *todo, nil
+}
+
+// rawRecord is a record as stored, a nil value is a missing record
+type rawRecord struct {
+	key   string
+	value []byte
+}
+
+// commit writes and erases the records of a transaction, all or none of them:
+// the records replaced by the writes are kept, and restored when a write fails.
+// The caller holds mu
+func (f *FileStorageTodoRepository) commit(writes []txWrite) error {
+	if f.closed {
+		return errors.WithStack(ErrClosed)
+	}
+
+	// encoding every record first leaves only the disk to fail once writing started
+	records := make([]rawRecord, 0, len(writes))
+	for _, w := range writes {
+		record := rawRecord{key: w.id.String()}
+		if w.todo != nil {
+			value, err := f.encode(*w.todo)
+			if err != nil {
+				return err
+			}
+			record.value = value
+		}
+		records = append(records, record)
+	}
+
+	previous := make([]rawRecord, 0, len(records))
+	for _, record := range records {
+		value, err := f.disk.Read(record.key)
+		if os.IsNotExist(err) {
+			value, err = nil, nil
+		}
+		if err != nil {
+			return f.rollback(previous, errors.WithStack(err))
+		}
+		if record.value != nil {
+			err = f.disk.Write(record.key, record.value)
+		} else if value != nil {
+			err = f.disk.Erase(record.key)
+		}
+		if err != nil {
+			return f.rollback(previous, errors.WithStack(err))
+		}
+		previous = append(previous, rawRecord{key: record.key, value: value})
+	}
+	for _, record := range records {
+		f.repaired(record.key)
+	}
+	return nil
+}
+
+// rollback restores the records replaced by a failed commit, latest first,
+// and returns the error failing the commit
+func (f *FileStorageTodoRepository) rollback(previous []rawRecord, err error) error {
+	for i := len(previous) - 1; i >= 0; i-- {
+		var restoreErr error
+		if previous[i].value != nil {
+			restoreErr = f.disk.Write(previous[i].key, previous[i].value)
+		} else {
+			restoreErr = f.disk.Erase(previous[i].key)
+		}
+		if restoreErr != nil && !os.IsNotExist(restoreErr) {
+			return errors.Wrapf(err, "restore record %s: %v", previous[i].key, restoreErr)
+		}
 	}
 	return err
 }
 
-// DeleteTodo deletes todo
-func (f *FileStorageTodoRepository) DeleteTodo(todoID uuid.UUID) error {
-	err := f.disk.Erase(todoID.String())
+// Lock locks the folder of the records until Close, or until the process exits,
+// so that no other process locking it writes them at the same time.
+// It fails with ErrLocked while another process holds the lock
+func (f *FileStorageTodoRepository) Lock() error {
+	return f.takeLock(false)
+}
+
+// LockShared locks the folder of the records for reading until Close, or until the process exits:
+// processes which only read the records hold it together, but never along with Lock.
+// It fails with ErrLocked while another process holds the lock of Lock
+func (f *FileStorageTodoRepository) LockShared() error {
+	return f.takeLock(true)
+}
+
+// takeLock locks the folder of the records, shared or exclusive
+func (f *FileStorageTodoRepository) takeLock(shared bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lock != nil {
+		return nil
+	}
+	lock, err := lockDir(f.disk.BasePath, shared)
 	if err != nil {
-		err = errors.WithStack(err)
 		return err
 	}
+	f.lock = lock
+	return nil
+}
+
+// Close waits for in-flight writes to complete, then rejects new ones with ErrClosed,
+// and releases the lock taken by Lock.
+// Reads are still served, so requests draining on shutdown can complete
+func (f *FileStorageTodoRepository) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.lock == nil {
+		return nil
+	}
+	err := f.lock.Close()
+	f.lock = nil
+	return errors.WithStack(err)
+}
+
+// write encodes todo, encrypts it when a keyring is configured
+// and stores it under its id
+func (f *FileStorageTodoRepository) write(todo models.Todo) error {
+	if f.closed {
+		return errors.WithStack(ErrClosed)
+	}
+	value, err := f.encode(todo)
+	if err != nil {
+		return err
+	}
+	err = f.disk.Write(todo.ID.String(), value)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	f.repaired(todo.ID.String())
 	return nil
 }
+
+// encode serializes todo with gob, and seals it when a keyring is configured
+func (f *FileStorageTodoRepository) encode(todo models.Todo) ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(todo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if f.keyring == nil {
+		return buffer.Bytes(), nil
+	}
+	return f.keyring.Seal(buffer.Bytes())
+}
+
+// decode deserializes a record, opening it first when it is encrypted.
+// Plaintext records are rejected once a keyring is configured
+func (f *FileStorageTodoRepository) decode(value []byte) (models.Todo, error) {
+	if f.keyring != nil && !encryption.IsSealed(value) {
+		return models.Todo{}, errors.New("record is not encrypted, rotate-keys encrypts it")
+	}
+	return f.decodeRecord(value)
+}
+
+// decodeRecord deserializes a record, opening it first when it is encrypted
+func (f *FileStorageTodoRepository) decodeRecord(value []byte) (models.Todo, error) {
+	var (
+		todo models.Todo
+		err  error
+	)
+	if encryption.IsSealed(value) {
+		if f.keyring == nil {
+			return todo, errors.New("record is encrypted but no keyring is configured")
+		}
+		value, err = f.keyring.Open(value)
+		if err != nil {
+			return todo, err
+		}
+	}
+	dec := gob.NewDecoder(bytes.NewReader(value))
+	err = dec.Decode(&todo)
+	if err != nil {
+		return todo, errors.WithStack(err)
+	}
+	return todo, nil
+}
+
+// Reencrypt rewrites every record with the active key of the keyring, in the current
+// record version, including plaintext records written before encryption was enabled.
+// It returns the number of rewritten records
+func (f *FileStorageTodoRepository) Reencrypt() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.keyring == nil {
+		return 0, errors.New("no keyring is configured")
+	}
+
+	var (
+		cancel = make(chan struct{})
+		keys   []string
+		n      int
+	)
+	defer close(cancel)
+	for key := range f.keys(cancel) {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		value, err := f.disk.Read(key)
+		if err != nil {
+			return n, errors.WithStack(err)
+		}
+		if f.keyring.IsCurrent(value) {
+			continue
+		}
+		todo, err := f.decodeRecord(value)
+		if err != nil {
+			return n, errors.Wrapf(err, "decode record %s", key)
+		}
+		value, err = f.encode(todo)
+		if err != nil {
+			return n, err
+		}
+		err = f.disk.Write(key, value)
+		if err != nil {
+			return n, errors.WithStack(err)
+		}
+		n++
+	}
+	return n, nil
+}
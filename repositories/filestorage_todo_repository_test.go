@@ -0,0 +1,266 @@
+package repositories
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elumbantoruan/todo/encryption"
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorageTodoRepository_GetTodo_SkipsCorrupt(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	repo := NewFileStorageTodoRepository(dir)
+	todo := newTodo()
+	repo.AddTodo(ctx, todo)
+
+	corruptKey := uuid.New().String()
+	ioutil.WriteFile(filepath.Join(dir, corruptKey), []byte("not a gob"), 0644)
+
+	list, err := repo.GetTodo(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, todo.ID, list[0].ID)
+	assert.Equal(t, []string{corruptKey}, repo.CorruptRecords(ctx))
+
+	// a listing cut short keeps the report of the latest complete one
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	repo.GetTodo(canceled)
+	assert.Equal(t, []string{corruptKey}, repo.CorruptRecords(ctx))
+
+	// erasing the record repairs it
+	assert.Nil(t, repo.DeleteTodo(ctx, uuid.MustParse(corruptKey)))
+	assert.Empty(t, repo.CorruptRecords(ctx))
+}
+
+func TestFileStorageTodoRepository_GetTodo_SkipsNonRecords(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	repo := NewFileStorageTodoRepository(dir)
+	todo := newTodo()
+	repo.AddTodo(ctx, todo)
+	// the records of a tenant live in a subdirectory of the data directory
+	tenant := NewFileStorageTodoRepository(filepath.Join(dir, "acme"))
+	tenant.AddTodo(ctx, newTodo())
+	// the readiness check probes the data directory with dot-files
+	ioutil.WriteFile(filepath.Join(dir, ".readyz123"), nil, 0600)
+
+	list, err := repo.GetTodo(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, todo.ID, list[0].ID)
+	assert.Empty(t, repo.CorruptRecords(ctx))
+
+	report, err := repo.Verify("")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Checked)
+}
+
+func TestFileStorageTodoRepository_GetTodo_Canceled(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	repo := NewFileStorageTodoRepository(dir)
+	repo.AddTodo(ctx, newTodo())
+	cancel()
+
+	_, err := repo.GetTodo(ctx)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestFileStorageTodoRepository_Transact_Rollback(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	repo := NewFileStorageTodoRepository(dir)
+	updated := newTodo()
+	repo.AddTodo(ctx, updated)
+	deleted := newTodo()
+	repo.AddTodo(ctx, deleted)
+	added := newTodo()
+	// a folder in place of its record fails the last write of the commit
+	failing := newTodo()
+	os.Mkdir(filepath.Join(dir, failing.ID.String()), 0755)
+
+	err := repo.Transact(ctx, func(tx TodoRepositoryV2) error {
+		assert.Nil(t, tx.AddTodo(ctx, added))
+		assert.Nil(t, tx.UpdateTodo(ctx, updated.ID, true, nil))
+		assert.Nil(t, tx.DeleteTodo(ctx, deleted.ID))
+		assert.Nil(t, tx.AddTodo(ctx, failing))
+		return nil
+	})
+	assert.NotNil(t, err)
+
+	// the records written before the failure are restored
+	_, err = repo.GetTodoByID(ctx, added.ID)
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+	todo, err := repo.GetTodoByID(ctx, updated.ID)
+	if assert.Nil(t, err) {
+		assert.False(t, todo.Completed)
+	}
+	_, err = repo.GetTodoByID(ctx, deleted.ID)
+	assert.Nil(t, err)
+	list, _ := repo.GetTodo(ctx)
+	assert.Equal(t, 2, len(list))
+}
+
+func TestFileStorageTodoRepository_Verify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	quarantine := filepath.Join(dir, "quarantine")
+	dataDir := filepath.Join(dir, "data")
+
+	repo := NewFileStorageTodoRepository(dataDir)
+	valid := newTodo()
+	repo.AddTodo(ctx, valid)
+
+	// a todo stored under another todo's filename
+	misplaced := newTodo()
+	repo.AddTodo(ctx, misplaced)
+	value, _ := repo.disk.Read(misplaced.ID.String())
+	repo.disk.Write(uuid.New().String(), value)
+
+	// a todo with twice the same task
+	dups := newTodo()
+	dups.Tasks = append(dups.Tasks, dups.Tasks[0])
+	repo.AddTodo(ctx, dups)
+
+	corruptKey := uuid.New().String()
+	repo.disk.Write(corruptKey, []byte("not a gob"))
+
+	report, err := repo.Verify(quarantine)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, report.Checked)
+	assert.Equal(t, 3, len(report.Problems))
+
+	list, _ := repo.GetTodo(ctx)
+	assert.Equal(t, 2, len(list))
+	_, err = os.Stat(filepath.Join(quarantine, corruptKey))
+	assert.Nil(t, err)
+}
+
+func TestFileStorageTodoRepository_Encryption(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	dataDir := filepath.Join(dir, "data")
+
+	// a plaintext record written before encryption was enabled
+	plain := newTodo()
+	NewFileStorageTodoRepository(dataDir).AddTodo(ctx, plain)
+
+	keyring, _ := encryption.LoadOrCreateKeyring(filepath.Join(dir, "keys.json"))
+	keyring.Rotate()
+	repo := NewFileStorageTodoRepositoryWithOptions(FileStorageOptions{
+		Path:    dataDir,
+		Keyring: keyring,
+	})
+	sealed := newTodo()
+	repo.AddTodo(ctx, sealed)
+
+	value, _ := ioutil.ReadFile(filepath.Join(dataDir, sealed.ID.String()))
+	assert.True(t, encryption.IsSealed(value))
+
+	// plaintext records are not trusted once encryption is enabled
+	list, err := repo.GetTodo(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, []string{plain.ID.String()}, repo.CorruptRecords(ctx))
+
+	n, err := repo.Reencrypt()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	value, _ = ioutil.ReadFile(filepath.Join(dataDir, plain.ID.String()))
+	assert.True(t, encryption.IsSealed(value))
+	todo, err := repo.GetTodoByID(ctx, plain.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, plain.Name, todo.Name)
+	list, _ = repo.GetTodo(ctx)
+	assert.Equal(t, 2, len(list))
+
+	// records sealed with the active key are left as they are
+	n, err = repo.Reencrypt()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestFileStorageTodoRepository_Lock(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+
+	repo := NewFileStorageTodoRepository(dir)
+	assert.Nil(t, repo.Lock())
+	other := NewFileStorageTodoRepository(dir)
+	assert.Equal(t, ErrLocked, errors.Cause(other.Lock()))
+
+	assert.Nil(t, repo.Close())
+	assert.Nil(t, other.Lock())
+	assert.Nil(t, other.Close())
+}
+
+func TestFileStorageTodoRepository_LockShared(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+
+	// readers hold the lock together, but never along with a writer
+	repo := NewFileStorageTodoRepository(dir)
+	assert.Nil(t, repo.LockShared())
+	reader := NewFileStorageTodoRepository(dir)
+	assert.Nil(t, reader.LockShared())
+	writer := NewFileStorageTodoRepository(dir)
+	assert.Equal(t, ErrLocked, errors.Cause(writer.Lock()))
+
+	assert.Nil(t, repo.Close())
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, writer.Lock())
+	assert.Equal(t, ErrLocked, errors.Cause(reader.LockShared()))
+	assert.Nil(t, writer.Close())
+}
+
+func TestFileStorageTodoRepository_Close(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	repo := NewFileStorageTodoRepository(dir)
+	todo := newTodo()
+	repo.AddTodo(ctx, todo)
+	assert.Nil(t, repo.Close())
+
+	err := repo.AddTodo(ctx, newTodo())
+	assert.Equal(t, ErrClosed, errors.Cause(err))
+
+	// reads are still served after Close
+	stored, err := repo.GetTodoByID(ctx, todo.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, todo.ID, stored.ID)
+}
+
+func newTodo() models.Todo {
+	return models.Todo{
+		ID:   uuid.New(),
+		Name: "todo",
+		Tasks: []models.Task{
+			{
+				ID:   uuid.New(),
+				Name: "task",
+			},
+		},
+	}
+}
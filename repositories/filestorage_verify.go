@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// VerifyReport is the result of verifying every record of a FileStorageTodoRepository
+type VerifyReport struct {
+	StartedAt  time.Time       `json:"startedAt"`
+	Checked    int             `json:"checked"`
+	Quarantine string          `json:"quarantine,omitempty"`
+	Problems   []RecordProblem `json:"problems"`
+}
+
+// RecordProblem describes a record which failed verification
+type RecordProblem struct {
+	Key         string `json:"key"`
+	Reason      string `json:"reason"`
+	Quarantined bool   `json:"quarantined"`
+}
+
+// Verify decodes every record and checks that the filename matches Todo.ID,
+// that identifiers are set and that task identifiers are unique.
+// When quarantineDir is not empty, bad records are moved into it and
+// the report is written next to them; otherwise the store is left untouched
+func (f *FileStorageTodoRepository) Verify(quarantineDir string) (*VerifyReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	report := &VerifyReport{
+		StartedAt:  time.Now().UTC(),
+		Quarantine: quarantineDir,
+		Problems:   []RecordProblem{},
+	}
+
+	// collect the keys first, quarantining erases records while walking
+	var (
+		cancel = make(chan struct{})
+		keys   []string
+	)
+	defer close(cancel)
+	for key := range f.keys(cancel) {
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		report.Checked++
+		reason := f.verifyRecord(key)
+		if reason == "" {
+			continue
+		}
+		problem := RecordProblem{
+			Key:    key,
+			Reason: reason,
+		}
+		if quarantineDir != "" {
+			err := f.quarantine(key, quarantineDir)
+			if err != nil {
+				return report, err
+			}
+			problem.Quarantined = true
+		}
+		report.Problems = append(report.Problems, problem)
+	}
+
+	if quarantineDir != "" && len(report.Problems) > 0 {
+		err := writeReport(report, quarantineDir)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// verifyRecord returns the reason why the record stored under key is invalid,
+// or an empty string when it is valid
+func (f *FileStorageTodoRepository) verifyRecord(key string) string {
+	value, err := f.disk.Read(key)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+
+	// plaintext records are fine, rotate-keys encrypts them
+	todo, err := f.decodeRecord(value)
+	if err != nil {
+		return fmt.Sprintf("undecodable: %v", err)
+	}
+
+	if todo.ID == uuid.Nil {
+		return "todo has no id"
+	}
+	if key != todo.ID.String() {
+		return fmt.Sprintf("filename does not match todoID %s", todo.ID)
+	}
+	tasks := make(map[uuid.UUID]bool, len(todo.Tasks))
+	for i, task := range todo.Tasks {
+		if task.ID == uuid.Nil {
+			return fmt.Sprintf("task #%d has no id", i)
+		}
+		if tasks[task.ID] {
+			return fmt.Sprintf("duplicate taskId %s", task.ID)
+		}
+		tasks[task.ID] = true
+	}
+	return ""
+}
+
+// quarantine moves the raw record stored under key into dir
+func (f *FileStorageTodoRepository) quarantine(key, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	value, err := f.disk.Read(key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, key), value, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = f.disk.Erase(key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// writeReport stores report as JSON in dir
+func writeReport(report *VerifyReport, dir string) error {
+	bts, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	name := fmt.Sprintf("report-%s.json", report.StartedAt.Format("20060102T150405Z"))
+	err = ioutil.WriteFile(filepath.Join(dir, name), bts, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package repositories
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// lockDir only creates the folder path, folders are not locked on this platform
+func lockDir(path string, shared bool) (io.Closer, error) {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package repositories
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// lockDir takes a shared or an exclusive lock on the folder path, created when missing.
+// The lock is released by closing the returned file, or when the process exits
+func lockDir(path string, shared bool) (io.Closer, error) {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+	err = syscall.Flock(int(dir.Fd()), how|syscall.LOCK_NB)
+	if err != nil {
+		dir.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errors.Wrap(ErrLocked, path)
+		}
+		return nil, errors.WithStack(err)
+	}
+	return dir, nil
+}
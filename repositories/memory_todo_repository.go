@@ -0,0 +1,339 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// MemoryTodoRepository keeps todos in memory, in the order they were added.
+// Nothing survives a restart, it is meant for development and tests
+type MemoryTodoRepository struct {
+	mu     sync.RWMutex
+	todos  map[uuid.UUID]models.Todo
+	order  []uuid.UUID
+	closed bool
+}
+
+// NewMemoryTodoRepository creates an empty instance of MemoryTodoRepository
+func NewMemoryTodoRepository() *MemoryTodoRepository {
+	return &MemoryTodoRepository{
+		todos: make(map[uuid.UUID]models.Todo),
+	}
+}
+
+// AddTodo adds new todo
+func (m *MemoryTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	if _, ok := m.todos[todo.ID]; ok {
+		return errors.New("duplicate todoID")
+	}
+	m.todos[todo.ID] = cloneTodo(todo)
+	m.order = append(m.order, todo.ID)
+	return nil
+}
+
+// AddTask adds task to existing todo
+func (m *MemoryTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	for _, t := range todo.Tasks {
+		if t.ID == task.ID {
+			return errors.New("duplicate taskId")
+		}
+	}
+	todo.Tasks = append(todo.Tasks, task)
+	m.todos[todoID] = todo
+	return nil
+}
+
+// GetTodo return list of todo
+func (m *MemoryTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var todoList []models.Todo
+	for _, id := range m.order {
+		todoList = append(todoList, cloneTodo(m.todos[id]))
+	}
+	return todoList, nil
+}
+
+// IterateTodo iterates over a snapshot of the todos
+func (m *MemoryTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	todoList, err := m.GetTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewSliceTodoIterator(ctx, todoList), nil
+}
+
+// GetTodoByID return todo by id
+func (m *MemoryTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return nil, notFound(todoID)
+	}
+	todo = cloneTodo(todo)
+	return &todo, nil
+}
+
+// UpdateTodo updates todo
+func (m *MemoryTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	todo.Completed = completed
+	todo.DueDate = dueDate
+	m.todos[todoID] = cloneTodo(todo)
+	return nil
+}
+
+// UpdateTask updates task for a specific todo
+func (m *MemoryTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	for i := 0; i < len(todo.Tasks); i++ {
+		if todo.Tasks[i].ID == taskID {
+			todo.Tasks[i].SetCompleted(completed, completedBy, time.Now().UTC())
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteTask deletes task
+func (m *MemoryTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	for i := 0; i < len(todo.Tasks); i++ {
+		if todo.Tasks[i].ID == taskID {
+			todo.Tasks = append(todo.Tasks[:i:i], todo.Tasks[i+1:]...)
+			break
+		}
+	}
+	m.todos[todoID] = todo
+	return nil
+}
+
+// DeleteTodo deletes todo
+func (m *MemoryTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	if _, ok := m.todos[todoID]; !ok {
+		return notFound(todoID)
+	}
+	delete(m.todos, todoID)
+	for i, id := range m.order {
+		if id == todoID {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ShareTodo shares todo with a collaborator, or changes its role when already shared
+func (m *MemoryTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	todo.Collaborators = share(todo.Collaborators, collaborator)
+	m.todos[todoID] = todo
+	return nil
+}
+
+// UnshareTodo stops sharing todo with the collaborator userID
+func (m *MemoryTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	todo.Collaborators = unshare(todo.Collaborators, userID)
+	m.todos[todoID] = todo
+	return nil
+}
+
+// TagTodo adds tag to the tags of todo
+func (m *MemoryTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	err := addTag(&todo, tag)
+	if err != nil {
+		return err
+	}
+	m.todos[todoID] = todo
+	return nil
+}
+
+// ArchiveTodo archives or unarchives todo
+func (m *MemoryTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return notFound(todoID)
+	}
+	todo.Archived = archived
+	m.todos[todoID] = todo
+	return nil
+}
+
+// Transact calls fn with a transaction over the todos, see Transactor.
+// The todos are locked until the transaction ends
+func (m *MemoryTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(ctx); err != nil {
+		return err
+	}
+	return transact(ctx, m, fn)
+}
+
+// load returns the todo todoID. The caller holds mu
+func (m *MemoryTodoRepository) load(ctx context.Context, todoID uuid.UUID) (models.Todo, error) {
+	todo, ok := m.todos[todoID]
+	if !ok {
+		return models.Todo{}, notFound(todoID)
+	}
+	return cloneTodo(todo), nil
+}
+
+// list returns every todo, in the order they were added. The caller holds mu
+func (m *MemoryTodoRepository) list(ctx context.Context) ([]models.Todo, error) {
+	todoList := make([]models.Todo, 0, len(m.order))
+	for _, id := range m.order {
+		todoList = append(todoList, cloneTodo(m.todos[id]))
+	}
+	return todoList, nil
+}
+
+// commit applies the writes of a transaction. The caller holds mu
+func (m *MemoryTodoRepository) commit(writes []txWrite) error {
+	for _, w := range writes {
+		_, exists := m.todos[w.id]
+		switch {
+		case w.todo == nil && exists:
+			delete(m.todos, w.id)
+			for i, id := range m.order {
+				if id == w.id {
+					m.order = append(m.order[:i], m.order[i+1:]...)
+					break
+				}
+			}
+		case w.todo != nil:
+			if !exists {
+				m.order = append(m.order, w.id)
+			}
+			m.todos[w.id] = *w.todo
+		}
+	}
+	return nil
+}
+
+// Close rejects new writes with ErrClosed
+func (m *MemoryTodoRepository) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	return nil
+}
+
+// writable returns the error of a write made now. The caller holds mu
+func (m *MemoryTodoRepository) writable(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if m.closed {
+		return errors.WithStack(ErrClosed)
+	}
+	return nil
+}
+
+// notFound returns the error the file storage returns for a missing todo,
+// so callers handle both backends alike
+func notFound(todoID uuid.UUID) error {
+	return errors.WithStack(&os.PathError{Op: "open", Path: todoID.String(), Err: syscall.ENOENT})
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryTodoRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryTodoRepository()
+
+	todo := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, todo))
+	assert.NotNil(t, repo.AddTodo(ctx, todo))
+	assert.Nil(t, repo.UpdateTask(ctx, todo.ID, todo.Tasks[0].ID, true, "alice"))
+
+	stored, err := repo.GetTodoByID(ctx, todo.ID)
+	assert.Nil(t, err)
+	assert.True(t, stored.Tasks[0].Completed)
+	assert.Equal(t, "alice", stored.Tasks[0].CompletedBy)
+	assert.NotNil(t, stored.Tasks[0].CompletedAt)
+
+	// reopening the task clears its completion
+	assert.Nil(t, repo.UpdateTask(ctx, todo.ID, todo.Tasks[0].ID, false, "bob"))
+	stored, _ = repo.GetTodoByID(ctx, todo.ID)
+	assert.Equal(t, "", stored.Tasks[0].CompletedBy)
+	assert.Nil(t, stored.Tasks[0].CompletedAt)
+
+	// a missing todo reports the same error as the file storage
+	_, err = repo.GetTodoByID(ctx, uuid.New())
+	assert.True(t, strings.Contains(err.Error(), "no such file"))
+
+	// a tag is added once, up to models.MaxTags tags
+	assert.Nil(t, repo.TagTodo(ctx, todo.ID, "errands"))
+	assert.Nil(t, repo.TagTodo(ctx, todo.ID, "errands"))
+	assert.Nil(t, repo.ArchiveTodo(ctx, todo.ID, true))
+	stored, _ = repo.GetTodoByID(ctx, todo.ID)
+	assert.Equal(t, []string{"errands"}, stored.Tags)
+	assert.True(t, stored.Archived)
+	for i := 1; i < models.MaxTags; i++ {
+		assert.Nil(t, repo.TagTodo(ctx, todo.ID, fmt.Sprint(i)))
+	}
+	err = repo.TagTodo(ctx, todo.ID, "more")
+	assert.Equal(t, ErrTooManyTags, errors.Cause(err))
+
+	assert.Nil(t, repo.DeleteTodo(ctx, todo.ID))
+	list, err := repo.GetTodo(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list))
+}
@@ -103,6 +103,7 @@ func (m MockTodoRepository) DeleteTask(todoID uuid.UUID, taskID uuid.UUID) error
 func (m MockTodoRepository) DeleteTodo(todoID uuid.UUID) error {
 	for i := 0; i < len(list); i++ {
 		if list[i].ID == todoID {
+			delete(keys, todoID.String())
 			list = append(list[:i], list[i+1:]...)
 			break
 		}
@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrQuotaExceeded is returned when a write would store more todos or tasks than allowed
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrTooManyTasks is returned when a write would give a todo more tasks than allowed
+var ErrTooManyTasks = errors.New("too many tasks")
+
+// Quota limits the number of todos, the total number of tasks and the number of tasks
+// of a todo of a repository, 0 does not limit them. Wrapping the repository of each
+// tenant gives per-tenant quotas
+func Quota(maxTodos, maxTasks, maxTasksPerTodo int) Middleware {
+	return func(repo TodoRepositoryV2) TodoRepositoryV2 {
+		return &quotaTodoRepository{
+			repo:            repo,
+			maxTodos:        maxTodos,
+			maxTasks:        maxTasks,
+			maxTasksPerTodo: maxTasksPerTodo,
+		}
+	}
+}
+
+// quotaTodoRepository implements Quota
+type quotaTodoRepository struct {
+	repo            TodoRepositoryV2
+	maxTodos        int
+	maxTasks        int
+	maxTasksPerTodo int
+
+	// mu serializes the writes adding todos or tasks, so counts are checked and updated together
+	mu sync.Mutex
+	// counted tells whether todos and tasks hold the counts of repo,
+	// they are counted again after a transaction
+	counted bool
+	todos   int
+	tasks   int
+}
+
+// count counts the todos and tasks of repo unless they are known. The caller holds mu
+func (q *quotaTodoRepository) count(ctx context.Context) error {
+	if q.counted {
+		return nil
+	}
+	it, err := q.repo.IterateTodo(ctx)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	todos, tasks := 0, 0
+	for it.Next() {
+		todos++
+		tasks += len(it.Todo().Tasks)
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	q.todos, q.tasks, q.counted = todos, tasks, true
+	return nil
+}
+
+// reserve returns ErrQuotaExceeded unless todos more todos and tasks more tasks fit. The caller holds mu
+func (q *quotaTodoRepository) reserve(ctx context.Context, todos, tasks int) error {
+	if q.maxTodos == 0 && q.maxTasks == 0 {
+		return nil
+	}
+	err := q.count(ctx)
+	if err != nil {
+		return err
+	}
+	if q.maxTodos > 0 && q.todos+todos > q.maxTodos {
+		return errors.Wrapf(ErrQuotaExceeded, "%d todos allowed", q.maxTodos)
+	}
+	if q.maxTasks > 0 && q.tasks+tasks > q.maxTasks {
+		return errors.Wrapf(ErrQuotaExceeded, "%d tasks allowed", q.maxTasks)
+	}
+	return nil
+}
+
+// AddTodo adds new todo
+func (q *quotaTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	if q.maxTasksPerTodo > 0 && len(todo.Tasks) > q.maxTasksPerTodo {
+		return errors.Wrapf(ErrTooManyTasks, "%d tasks per todo allowed", q.maxTasksPerTodo)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := q.reserve(ctx, 1, len(todo.Tasks))
+	if err != nil {
+		return err
+	}
+	err = q.repo.AddTodo(ctx, todo)
+	if err != nil {
+		return err
+	}
+	q.todos++
+	q.tasks += len(todo.Tasks)
+	return nil
+}
+
+// AddTask adds task to existing todo
+func (q *quotaTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxTasksPerTodo > 0 {
+		todo, err := q.repo.GetTodoByID(ctx, todoID)
+		if err != nil {
+			return err
+		}
+		if len(todo.Tasks) >= q.maxTasksPerTodo {
+			return errors.Wrapf(ErrTooManyTasks, "%d tasks per todo allowed", q.maxTasksPerTodo)
+		}
+	}
+	err := q.reserve(ctx, 0, 1)
+	if err != nil {
+		return err
+	}
+	err = q.repo.AddTask(ctx, todoID, task)
+	if err != nil {
+		return err
+	}
+	q.tasks++
+	return nil
+}
+
+// GetTodo return list of todo
+func (q *quotaTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	return q.repo.GetTodo(ctx)
+}
+
+// IterateTodo iterates over todos
+func (q *quotaTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	return q.repo.IterateTodo(ctx)
+}
+
+// GetTodoByID return todo by id
+func (q *quotaTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	return q.repo.GetTodoByID(ctx, todoID)
+}
+
+// UpdateTodo updates todo
+func (q *quotaTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	return q.repo.UpdateTodo(ctx, todoID, completed, dueDate)
+}
+
+// UpdateTask updates task for a specific todo
+func (q *quotaTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	return q.repo.UpdateTask(ctx, todoID, taskID, completed, completedBy)
+}
+
+// DeleteTask deletes task
+func (q *quotaTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.counted {
+		return q.repo.DeleteTask(ctx, todoID, taskID)
+	}
+	todo, err := q.repo.GetTodoByID(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	err = q.repo.DeleteTask(ctx, todoID, taskID)
+	if err != nil {
+		return err
+	}
+	// deleting a task the todo does not have is not an error
+	for _, task := range todo.Tasks {
+		if task.ID == taskID {
+			q.tasks--
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteTodo deletes todo
+func (q *quotaTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.counted {
+		return q.repo.DeleteTodo(ctx, todoID)
+	}
+	todo, err := q.repo.GetTodoByID(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	err = q.repo.DeleteTodo(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	q.todos--
+	q.tasks -= len(todo.Tasks)
+	return nil
+}
+
+// ShareTodo shares todo with a collaborator
+func (q *quotaTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	return q.repo.ShareTodo(ctx, todoID, collaborator)
+}
+
+// UnshareTodo stops sharing todo with a collaborator
+func (q *quotaTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	return q.repo.UnshareTodo(ctx, todoID, userID)
+}
+
+// TagTodo adds tag to the tags of todo
+func (q *quotaTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	return q.repo.TagTodo(ctx, todoID, tag)
+}
+
+// ArchiveTodo archives or unarchives todo
+func (q *quotaTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	return q.repo.ArchiveTodo(ctx, todoID, archived)
+}
+
+// Close implements io.Closer
+func (q *quotaTodoRepository) Close() error {
+	return closeRepo(q.repo)
+}
+
+// Transact runs fn in a transaction of the wrapped repository, limited like the repository.
+// No other write adds todos or tasks while the transaction counts and fills its snapshot,
+// and the todos and tasks are counted again after the transaction
+func (q *quotaTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := Transact(ctx, q.repo, func(tx TodoRepositoryV2) error {
+		return fn(Quota(q.maxTodos, q.maxTasks, q.maxTasksPerTodo)(tx))
+	})
+	q.counted = false
+	return err
+}
+
+// CorruptRecords implements CorruptRecordReporter
+func (q *quotaTodoRepository) CorruptRecords(ctx context.Context) []string {
+	return corruptRecords(ctx, q.repo)
+}
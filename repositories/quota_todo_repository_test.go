@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	repo := Chain(NewMemoryTodoRepository(), Quota(2, 3, 0))
+
+	first := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, first))
+	second := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, second))
+	err := repo.AddTodo(ctx, newTodo())
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+
+	// the third task fits, not the fourth
+	task := newTodo().Tasks[0]
+	assert.Nil(t, repo.AddTask(ctx, first.ID, task))
+	task = newTodo().Tasks[0]
+	err = repo.AddTask(ctx, first.ID, task)
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+
+	// deletes free room
+	assert.Nil(t, repo.DeleteTodo(ctx, second.ID))
+	assert.Nil(t, repo.AddTask(ctx, first.ID, task))
+	err = repo.AddTodo(ctx, newTodo())
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+}
+
+func TestQuota_TasksPerTodo(t *testing.T) {
+	ctx := context.Background()
+	repo := Chain(NewMemoryTodoRepository(), Quota(0, 0, 2))
+
+	todo := newTodo()
+	todo.Tasks = append(todo.Tasks, newTodo().Tasks[0], newTodo().Tasks[0])
+	err := repo.AddTodo(ctx, todo)
+	assert.Equal(t, ErrTooManyTasks, errors.Cause(err))
+
+	todo = newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, todo))
+	assert.Nil(t, repo.AddTask(ctx, todo.ID, newTodo().Tasks[0]))
+	err = repo.AddTask(ctx, todo.ID, newTodo().Tasks[0])
+	assert.Equal(t, ErrTooManyTasks, errors.Cause(err))
+}
+
+// iterationCounter counts the iterations over the todos of the wrapped repository
+type iterationCounter struct {
+	TodoRepositoryV2
+	iterations int
+}
+
+func (c *iterationCounter) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	c.iterations++
+	return c.TodoRepositoryV2.IterateTodo(ctx)
+}
+
+func TestQuota_DeleteKeepsCounts(t *testing.T) {
+	ctx := context.Background()
+	counter := &iterationCounter{TodoRepositoryV2: NewMemoryTodoRepository()}
+	repo := Quota(2, 2, 0)(counter)
+
+	first := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, first))
+	second := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, second))
+
+	// deleting a task twice frees a single task
+	assert.Nil(t, repo.DeleteTask(ctx, first.ID, first.Tasks[0].ID))
+	assert.Nil(t, repo.DeleteTask(ctx, first.ID, first.Tasks[0].ID))
+	// deleting a todo frees its tasks
+	assert.Nil(t, repo.DeleteTodo(ctx, second.ID))
+
+	third := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, third))
+	assert.Nil(t, repo.AddTask(ctx, third.ID, newTodo().Tasks[0]))
+	err := repo.AddTask(ctx, third.ID, newTodo().Tasks[0])
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+	err = repo.AddTodo(ctx, newTodo())
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+
+	// the store is only counted by the first write
+	assert.Equal(t, 1, counter.iterations)
+}
+
+func TestQuota_Transact(t *testing.T) {
+	ctx := context.Background()
+	repo := Quota(1, 0, 0)(NewMemoryTodoRepository())
+	// the store is counted before the transaction
+	todo := newTodo()
+	assert.Nil(t, repo.AddTodo(ctx, todo))
+	assert.Nil(t, repo.DeleteTodo(ctx, todo.ID))
+
+	added := make(chan error, 1)
+	err := Transact(ctx, repo, func(tx TodoRepositoryV2) error {
+		// a write racing the transaction waits for it, then sees its todo
+		go func() { added <- repo.AddTodo(ctx, newTodo()) }()
+		select {
+		case err := <-added:
+			t.Fatalf("write completed during the transaction: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return tx.AddTodo(ctx, newTodo())
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(<-added))
+}
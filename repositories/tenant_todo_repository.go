@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// TenantTodoRepository routes every call to the repository of the tenant
+// carried by the context of the call, so tenants never see each other's todos.
+// The repository of a tenant is created on its first call. Calls without
+// a tenant, such as from the health checks, go to the default tenant
+type TenantTodoRepository struct {
+	defaultTenant string
+	newRepo       func(tenantID string) (TodoRepositoryV2, error)
+
+	mu     sync.Mutex
+	repos  map[string]TodoRepositoryV2
+	closed bool
+}
+
+// NewTenantTodoRepository creates an instance of TenantTodoRepository
+// creating the repository of a tenant with newRepo
+func NewTenantTodoRepository(defaultTenant string, newRepo func(tenantID string) (TodoRepositoryV2, error)) *TenantTodoRepository {
+	return &TenantTodoRepository{
+		defaultTenant: defaultTenant,
+		newRepo:       newRepo,
+		repos:         make(map[string]TodoRepositoryV2),
+	}
+}
+
+// repo returns the repository of the tenant of ctx, creating it when needed
+func (t *TenantTodoRepository) repo(ctx context.Context) (TodoRepositoryV2, error) {
+	id := tenant.FromContext(ctx)
+	if id == "" {
+		id = t.defaultTenant
+	}
+	if !tenant.Valid(id) {
+		return nil, errors.Errorf("invalid tenant %q", id)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, errors.WithStack(ErrClosed)
+	}
+	if repo, ok := t.repos[id]; ok {
+		return repo, nil
+	}
+	repo, err := t.newRepo(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating repository of tenant %s", id)
+	}
+	t.repos[id] = repo
+	return repo, nil
+}
+
+// Tenants returns the tenants whose repository was created, sorted
+func (t *TenantTodoRepository) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ids []string
+	for id := range t.repos {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AddTodo adds new todo
+func (t *TenantTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.AddTodo(ctx, todo)
+}
+
+// AddTask adds task to existing todo
+func (t *TenantTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.AddTask(ctx, todoID, task)
+}
+
+// GetTodo return list of todo
+func (t *TenantTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetTodo(ctx)
+}
+
+// IterateTodo iterates over todos
+func (t *TenantTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.IterateTodo(ctx)
+}
+
+// GetTodoByID return todo by id
+func (t *TenantTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetTodoByID(ctx, todoID)
+}
+
+// UpdateTodo updates todo
+func (t *TenantTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.UpdateTodo(ctx, todoID, completed, dueDate)
+}
+
+// UpdateTask updates task for a specific todo
+func (t *TenantTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.UpdateTask(ctx, todoID, taskID, completed, completedBy)
+}
+
+// DeleteTask deletes task
+func (t *TenantTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteTask(ctx, todoID, taskID)
+}
+
+// DeleteTodo deletes todo
+func (t *TenantTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteTodo(ctx, todoID)
+}
+
+// ShareTodo shares todo with a collaborator
+func (t *TenantTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.ShareTodo(ctx, todoID, collaborator)
+}
+
+// UnshareTodo stops sharing todo with a collaborator
+func (t *TenantTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.UnshareTodo(ctx, todoID, userID)
+}
+
+// TagTodo adds tag to the tags of todo in the repository of the tenant
+func (t *TenantTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.TagTodo(ctx, todoID, tag)
+}
+
+// ArchiveTodo archives or unarchives todo in the repository of the tenant
+func (t *TenantTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.ArchiveTodo(ctx, todoID, archived)
+}
+
+// Transact runs fn in a transaction of the repository of the tenant
+func (t *TenantTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return Transact(ctx, repo, fn)
+}
+
+// Close closes the repository of every tenant, later calls fail with ErrClosed
+func (t *TenantTodoRepository) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	var first error
+	for id, repo := range t.repos {
+		if err := closeRepo(repo); err != nil && first == nil {
+			first = errors.Wrapf(err, "closing repository of tenant %s", id)
+		}
+	}
+	return first
+}
+
+// CorruptRecords returns the records skipped by the repository of the tenant of ctx,
+// tenants never see the health of each other's storage
+func (t *TenantTodoRepository) CorruptRecords(ctx context.Context) []string {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil
+	}
+	return corruptRecords(ctx, repo)
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elumbantoruan/todo/tenant"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantTodoRepository(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tenants")
+	defer os.RemoveAll(dir)
+	repo := NewTenantTodoRepository("default", func(tenantID string) (TodoRepositoryV2, error) {
+		return NewFileStorageTodoRepository(filepath.Join(dir, tenantID)), nil
+	})
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+
+	todo := newTodo()
+	assert.Nil(t, repo.AddTodo(acme, todo))
+	assert.Nil(t, repo.AddTodo(context.Background(), newTodo()))
+
+	// tenants do not see each other's todos
+	_, err := repo.GetTodoByID(globex, todo.ID)
+	assert.NotNil(t, err)
+	list, _ := repo.GetTodo(globex)
+	assert.Equal(t, 0, len(list))
+	list, _ = repo.GetTodo(acme)
+	assert.Equal(t, 1, len(list))
+
+	// calls without a tenant go to the default tenant, each tenant has its own directory
+	list, _ = repo.GetTodo(context.Background())
+	assert.Equal(t, 1, len(list))
+	_, err = os.Stat(filepath.Join(dir, "acme", todo.ID.String()))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"acme", "default", "globex"}, repo.Tenants())
+
+	// tenants only see the corrupt records of their own storage
+	ioutil.WriteFile(filepath.Join(dir, "acme", "corrupt"), []byte("not a gob"), 0644)
+	repo.GetTodo(acme)
+	repo.GetTodo(globex)
+	assert.Equal(t, []string{"corrupt"}, repo.CorruptRecords(acme))
+	assert.Empty(t, repo.CorruptRecords(globex))
+
+	_, err = repo.GetTodo(tenant.NewContext(context.Background(), "../etc"))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, repo.Close())
+	err = repo.AddTodo(acme, newTodo())
+	assert.Equal(t, ErrClosed, errors.Cause(err))
+}
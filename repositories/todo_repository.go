@@ -1,13 +1,21 @@
 package repositories
 
 import (
+	"context"
+	"io"
 	"time"
 
 	"github.com/elumbantoruan/todo/models"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
+// ErrTooManyTags is returned when tagging a todo which already has models.MaxTags tags
+var ErrTooManyTags = errors.New("too many tags")
+
 // TodoRepository is an interface for repository
+// It is kept for backends which do not take a context,
+// use NewTodoRepositoryAdapter to turn one into a TodoRepositoryV2
 type TodoRepository interface {
 	AddTodo(todo models.Todo) error
 	AddTask(todoID uuid.UUID, task models.Task) error
@@ -18,3 +26,150 @@ type TodoRepository interface {
 	DeleteTask(todoID, taskID uuid.UUID) error
 	DeleteTodo(todoID uuid.UUID) error
 }
+
+// TodoRepositoryV2 is the context-aware interface for repository
+// Implementations give up as soon as possible once ctx is done,
+// and return an error wrapping ctx.Err()
+// UpdateTask records completedBy, the id of the user completing the task, with the time
+type TodoRepositoryV2 interface {
+	AddTodo(ctx context.Context, todo models.Todo) error
+	AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error
+	GetTodo(ctx context.Context) ([]models.Todo, error)
+	IterateTodo(ctx context.Context) (TodoIterator, error)
+	GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error)
+	UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error
+	UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error
+	DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error
+	DeleteTodo(ctx context.Context, todoID uuid.UUID) error
+	ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error
+	UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error
+	TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error
+	ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error
+}
+
+// CorruptRecordReporter is implemented by repositories which skip
+// records they cannot decode when listing todos
+type CorruptRecordReporter interface {
+	// CorruptRecords returns the keys of the records skipped by the latest
+	// complete listing of the storage ctx reaches, it does not change with
+	// the listings cut short
+	CorruptRecords(ctx context.Context) []string
+}
+
+// closeRepo closes repo, if it can be closed.
+// Decorators forward Close to the repository they wrap with it
+func closeRepo(repo interface{}) error {
+	if closer, ok := repo.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// corruptRecords returns the records skipped by repo, if it reports them.
+// Decorators forward CorruptRecords to the repository they wrap with it
+func corruptRecords(ctx context.Context, repo interface{}) []string {
+	if reporter, ok := repo.(CorruptRecordReporter); ok {
+		return reporter.CorruptRecords(ctx)
+	}
+	return nil
+}
+
+// TodoIterator iterates over todos without holding all of them in memory
+// It is used like sql.Rows
+//
+//	it, err := repo.IterateTodo(ctx)
+//	defer it.Close()
+//	for it.Next() {
+//		todo := it.Todo()
+//	}
+//	err = it.Err()
+type TodoIterator interface {
+	Next() bool
+	Todo() models.Todo
+	Err() error
+	Close() error
+}
+
+// sliceTodoIterator iterates over an in-memory list of todo
+type sliceTodoIterator struct {
+	ctx      context.Context
+	todoList []models.Todo
+	pos      int
+	err      error
+}
+
+// NewSliceTodoIterator returns a TodoIterator over todoList,
+// for backends which cannot do better than loading every todo
+func NewSliceTodoIterator(ctx context.Context, todoList []models.Todo) TodoIterator {
+	return &sliceTodoIterator{
+		ctx:      ctx,
+		todoList: todoList,
+		pos:      -1,
+	}
+}
+
+// Next advances to the next todo
+func (s *sliceTodoIterator) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = errors.WithStack(err)
+		return false
+	}
+	s.pos++
+	return s.pos < len(s.todoList)
+}
+
+// Todo returns the current todo
+func (s *sliceTodoIterator) Todo() models.Todo {
+	return s.todoList[s.pos]
+}
+
+// Err returns the error which stopped the iteration
+func (s *sliceTodoIterator) Err() error {
+	return s.err
+}
+
+// Close releases the iterator
+func (s *sliceTodoIterator) Close() error {
+	s.todoList = nil
+	return nil
+}
+
+// share returns collaborators with collaborator added, or updated when
+// a collaborator with the same user id is already present
+func share(collaborators []models.Collaborator, collaborator models.Collaborator) []models.Collaborator {
+	for i, c := range collaborators {
+		if c.UserID == collaborator.UserID {
+			collaborators[i] = collaborator
+			return collaborators
+		}
+	}
+	return append(collaborators, collaborator)
+}
+
+// addTag adds tag to the tags of todo unless it already has it,
+// or returns ErrTooManyTags when todo already has models.MaxTags tags
+func addTag(todo *models.Todo, tag string) error {
+	for _, t := range todo.Tags {
+		if t == tag {
+			return nil
+		}
+	}
+	if len(todo.Tags) >= models.MaxTags {
+		return errors.Wrapf(ErrTooManyTags, "todo %s", todo.ID)
+	}
+	todo.Tags = append(todo.Tags[:len(todo.Tags):len(todo.Tags)], tag)
+	return nil
+}
+
+// unshare returns collaborators without the collaborator userID
+func unshare(collaborators []models.Collaborator, userID string) []models.Collaborator {
+	for i, c := range collaborators {
+		if c.UserID == userID {
+			return append(collaborators[:i:i], collaborators[i+1:]...)
+		}
+	}
+	return collaborators
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// todoRepositoryAdapter adapts a TodoRepository to TodoRepositoryV2
+type todoRepositoryAdapter struct {
+	repo TodoRepository
+}
+
+// NewTodoRepositoryAdapter adapts a TodoRepository, which does not take a context,
+// to TodoRepositoryV2. Since a call cannot be interrupted, ctx is only checked
+// before calling repo
+func NewTodoRepositoryAdapter(repo TodoRepository) TodoRepositoryV2 {
+	return &todoRepositoryAdapter{
+		repo: repo,
+	}
+}
+
+// AddTodo adds new todo
+func (a *todoRepositoryAdapter) AddTodo(ctx context.Context, todo models.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return a.repo.AddTodo(todo)
+}
+
+// AddTask adds task to existing todo
+func (a *todoRepositoryAdapter) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return a.repo.AddTask(todoID, task)
+}
+
+// GetTodo return list of todo
+func (a *todoRepositoryAdapter) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a.repo.GetTodo()
+}
+
+// IterateTodo iterates over the list returned by GetTodo
+func (a *todoRepositoryAdapter) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	todoList, err := a.GetTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewSliceTodoIterator(ctx, todoList), nil
+}
+
+// GetTodoByID return todo by id
+func (a *todoRepositoryAdapter) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a.repo.GetTodoByID(todoID)
+}
+
+// UpdateTodo updates todo
+func (a *todoRepositoryAdapter) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return a.repo.UpdateTodo(todoID, completed, dueDate)
+}
+
+// UpdateTask updates task for a specific todo, TodoRepository does not record who completed it
+func (a *todoRepositoryAdapter) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return a.repo.UpdateTask(todoID, taskID, completed)
+}
+
+// DeleteTask deletes task
+func (a *todoRepositoryAdapter) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return a.repo.DeleteTask(todoID, taskID)
+}
+
+// DeleteTodo deletes todo
+func (a *todoRepositoryAdapter) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return a.repo.DeleteTodo(todoID)
+}
+
+// ShareTodo is not supported, TodoRepository cannot store collaborators
+func (a *todoRepositoryAdapter) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	return errors.New("sharing is not supported by this repository")
+}
+
+// UnshareTodo is not supported, TodoRepository cannot store collaborators
+func (a *todoRepositoryAdapter) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	return errors.New("sharing is not supported by this repository")
+}
+
+// TagTodo is not supported, TodoRepository cannot store tags
+func (a *todoRepositoryAdapter) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	return errors.New("tags are not supported by this repository")
+}
+
+// ArchiveTodo is not supported, TodoRepository cannot store the archived state
+func (a *todoRepositoryAdapter) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	return errors.New("archiving is not supported by this repository")
+}
+
+// Close implements io.Closer
+func (a *todoRepositoryAdapter) Close() error {
+	return closeRepo(a.repo)
+}
+
+// CorruptRecords implements CorruptRecordReporter
+func (a *todoRepositoryAdapter) CorruptRecords(ctx context.Context) []string {
+	return corruptRecords(ctx, a.repo)
+}
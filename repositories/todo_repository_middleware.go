@@ -0,0 +1,275 @@
+package repositories
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/elumbantoruan/todo/requestid"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware decorates a TodoRepository, such as to observe its calls
+type Middleware func(TodoRepositoryV2) TodoRepositoryV2
+
+// Chain wraps repo with every middleware, the first one being the outermost
+func Chain(repo TodoRepositoryV2, middlewares ...Middleware) TodoRepositoryV2 {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		repo = middlewares[i](repo)
+	}
+	return repo
+}
+
+// Logging logs one structured line per repository call
+// with the method, the todo id, the duration and the error if any
+func Logging(logger *slog.Logger) Middleware {
+	return func(repo TodoRepositoryV2) TodoRepositoryV2 {
+		return &observedTodoRepository{
+			repo: repo,
+			observe: func(ctx context.Context, method string, todoID uuid.UUID) (context.Context, func(error) error) {
+				start := time.Now()
+				return ctx, func(err error) error {
+					attrs := []interface{}{
+						slog.String("method", method),
+						slog.Duration("duration", time.Since(start)),
+					}
+					if todoID != uuid.Nil {
+						attrs = append(attrs, slog.String("todoID", todoID.String()))
+					}
+					if id := requestid.FromContext(ctx); id != "" {
+						attrs = append(attrs, slog.String("requestID", id))
+					}
+					if err != nil {
+						logger.Error("todo repository call failed", append(attrs, slog.String("error", err.Error()))...)
+						return err
+					}
+					logger.Info("todo repository call", attrs...)
+					return nil
+				}
+			},
+		}
+	}
+}
+
+// Metrics records the latency of every repository call in a histogram
+// labelled by method and result, registered with reg
+func Metrics(reg prometheus.Registerer) Middleware {
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "todo_repository_operation_duration_seconds",
+		Help:    "Latency of TodoRepository operations.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"method", "result"})
+	reg.MustRegister(latency)
+
+	return func(repo TodoRepositoryV2) TodoRepositoryV2 {
+		return &observedTodoRepository{
+			repo: repo,
+			observe: func(ctx context.Context, method string, todoID uuid.UUID) (context.Context, func(error) error) {
+				start := time.Now()
+				return ctx, func(err error) error {
+					result := "ok"
+					if err != nil {
+						result = "error"
+					}
+					latency.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+					return err
+				}
+			},
+		}
+	}
+}
+
+// Tracing starts a span per repository call with tracer,
+// as a child of the span carried by the context of the call
+func Tracing(tracer trace.Tracer) Middleware {
+	return func(repo TodoRepositoryV2) TodoRepositoryV2 {
+		return &observedTodoRepository{
+			repo: repo,
+			observe: func(ctx context.Context, method string, todoID uuid.UUID) (context.Context, func(error) error) {
+				ctx, span := tracer.Start(ctx, "TodoRepository."+method,
+					trace.WithSpanKind(trace.SpanKindClient))
+				if todoID != uuid.Nil {
+					span.SetAttributes(attribute.String("todo.id", todoID.String()))
+				}
+				return ctx, func(err error) error {
+					if err != nil {
+						span.RecordError(err)
+						span.SetStatus(codes.Error, err.Error())
+					}
+					span.End()
+					return err
+				}
+			},
+		}
+	}
+}
+
+// RequestID wraps the errors of every repository call with the request id
+// carried by the context of the call, so errors can be traced back to a request
+func RequestID() Middleware {
+	return func(repo TodoRepositoryV2) TodoRepositoryV2 {
+		return &observedTodoRepository{
+			repo: repo,
+			observe: func(ctx context.Context, method string, todoID uuid.UUID) (context.Context, func(error) error) {
+				return ctx, func(err error) error {
+					id := requestid.FromContext(ctx)
+					if err == nil || id == "" {
+						return err
+					}
+					return errors.Wrapf(err, "request %s", id)
+				}
+			},
+		}
+	}
+}
+
+// observedTodoRepository calls observe around every call to repo.
+// observe is called before the call and returns the context passed to repo
+// and the function called with its result, which returns the error to return
+type observedTodoRepository struct {
+	repo    TodoRepositoryV2
+	observe func(ctx context.Context, method string, todoID uuid.UUID) (context.Context, func(error) error)
+}
+
+// AddTodo adds new todo
+func (o *observedTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	ctx, done := o.observe(ctx, "AddTodo", todo.ID)
+	err := o.repo.AddTodo(ctx, todo)
+	return done(err)
+}
+
+// AddTask adds task to existing todo
+func (o *observedTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	ctx, done := o.observe(ctx, "AddTask", todoID)
+	err := o.repo.AddTask(ctx, todoID, task)
+	return done(err)
+}
+
+// GetTodo return list of todo
+func (o *observedTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	ctx, done := o.observe(ctx, "GetTodo", uuid.Nil)
+	todoList, err := o.repo.GetTodo(ctx)
+	return todoList, done(err)
+}
+
+// IterateTodo iterates over todos, the call is observed until the iterator is closed
+func (o *observedTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	ctx, done := o.observe(ctx, "IterateTodo", uuid.Nil)
+	it, err := o.repo.IterateTodo(ctx)
+	if err != nil {
+		return nil, done(err)
+	}
+	return &observedTodoIterator{
+		TodoIterator: it,
+		done:         done,
+	}, nil
+}
+
+// GetTodoByID return todo by id
+func (o *observedTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	ctx, done := o.observe(ctx, "GetTodoByID", todoID)
+	todo, err := o.repo.GetTodoByID(ctx, todoID)
+	return todo, done(err)
+}
+
+// UpdateTodo updates todo
+func (o *observedTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	ctx, done := o.observe(ctx, "UpdateTodo", todoID)
+	err := o.repo.UpdateTodo(ctx, todoID, completed, dueDate)
+	return done(err)
+}
+
+// UpdateTask updates task for a specific todo
+func (o *observedTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	ctx, done := o.observe(ctx, "UpdateTask", todoID)
+	err := o.repo.UpdateTask(ctx, todoID, taskID, completed, completedBy)
+	return done(err)
+}
+
+// DeleteTask deletes task
+func (o *observedTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	ctx, done := o.observe(ctx, "DeleteTask", todoID)
+	err := o.repo.DeleteTask(ctx, todoID, taskID)
+	return done(err)
+}
+
+// DeleteTodo deletes todo
+func (o *observedTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	ctx, done := o.observe(ctx, "DeleteTodo", todoID)
+	err := o.repo.DeleteTodo(ctx, todoID)
+	return done(err)
+}
+
+// Close implements io.Closer
+func (o *observedTodoRepository) Close() error {
+	return closeRepo(o.repo)
+}
+
+// ShareTodo shares todo with a collaborator
+func (o *observedTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	ctx, done := o.observe(ctx, "ShareTodo", todoID)
+	err := o.repo.ShareTodo(ctx, todoID, collaborator)
+	return done(err)
+}
+
+// UnshareTodo stops sharing todo with a collaborator
+func (o *observedTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	ctx, done := o.observe(ctx, "UnshareTodo", todoID)
+	err := o.repo.UnshareTodo(ctx, todoID, userID)
+	return done(err)
+}
+
+// TagTodo adds tag to the tags of todo
+func (o *observedTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	ctx, done := o.observe(ctx, "TagTodo", todoID)
+	err := o.repo.TagTodo(ctx, todoID, tag)
+	return done(err)
+}
+
+// ArchiveTodo archives or unarchives todo
+func (o *observedTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	ctx, done := o.observe(ctx, "ArchiveTodo", todoID)
+	err := o.repo.ArchiveTodo(ctx, todoID, archived)
+	return done(err)
+}
+
+// Transact runs fn in a transaction of the wrapped repository, the calls made
+// to the transaction are observed as well
+func (o *observedTodoRepository) Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error {
+	ctx, done := o.observe(ctx, "Transact", uuid.Nil)
+	err := Transact(ctx, o.repo, func(tx TodoRepositoryV2) error {
+		return fn(&observedTodoRepository{repo: tx, observe: o.observe})
+	})
+	return done(err)
+}
+
+// CorruptRecords implements CorruptRecordReporter
+func (o *observedTodoRepository) CorruptRecords(ctx context.Context) []string {
+	return corruptRecords(ctx, o.repo)
+}
+
+// observedTodoIterator reports the end of an iteration to done when closed
+type observedTodoIterator struct {
+	TodoIterator
+	done func(error) error
+}
+
+// Close releases the iterator
+func (o *observedTodoIterator) Close() error {
+	err := o.TodoIterator.Close()
+	if o.done != nil {
+		result := o.Err()
+		if result == nil {
+			result = err
+		}
+		o.done(result)
+		o.done = nil
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain_LoggingMetrics(t *testing.T) {
+	mockRepo := MockTodoRepository{}
+	mockRepo.Clear()
+	ctx := context.Background()
+
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+	reg := prometheus.NewRegistry()
+
+	repo := Chain(NewTodoRepositoryAdapter(mockRepo), Metrics(reg), Logging(logger))
+	todo := newTodo()
+	repo.AddTodo(ctx, todo)
+	repo.GetTodoByID(ctx, todo.ID)
+
+	var line map[string]interface{}
+	json.NewDecoder(&buffer).Decode(&line)
+	assert.Equal(t, "AddTodo", line["method"])
+	assert.Equal(t, todo.ID.String(), line["todoID"])
+
+	count, _ := testutil.GatherAndCount(reg, "todo_repository_operation_duration_seconds")
+	assert.Equal(t, 2, count)
+}
+
+func TestChain_Forwarding(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	storage := NewFileStorageTodoRepository(dir)
+	corruptKey := uuid.New().String()
+	ioutil.WriteFile(filepath.Join(dir, corruptKey), []byte("not a gob"), 0644)
+	storage.GetTodo(ctx)
+
+	// every decorator forwards CorruptRecords and Close to the storage
+	repo := Chain(NewCachedTodoRepository(storage, 10, time.Minute),
+		RequestID(), Logging(slog.New(slog.NewTextHandler(ioutil.Discard, nil))), ACL(), Quota(10, 0, 0))
+	assert.Equal(t, []string{corruptKey}, repo.(CorruptRecordReporter).CorruptRecords(ctx))
+	assert.Nil(t, repo.(io.Closer).Close())
+	err := storage.AddTodo(ctx, newTodo())
+	assert.Equal(t, ErrClosed, errors.Cause(err))
+}
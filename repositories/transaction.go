@@ -0,0 +1,292 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrNotTransactional is returned by Transact when the repository does not support transactions
+var ErrNotTransactional = errors.New("transactions are not supported by this repository")
+
+// errTransactionDone is returned by the calls made to a transaction once it ended
+var errTransactionDone = errors.New("transaction already committed or rolled back")
+
+// Transactor is implemented by repositories applying a group of writes atomically
+type Transactor interface {
+	// Transact calls fn with a repository staging its writes, and commits them
+	// when fn returns nil. When fn returns an error none of them is applied.
+	// Other writes wait for the transaction to end
+	Transact(ctx context.Context, fn func(tx TodoRepositoryV2) error) error
+}
+
+// Transact runs fn in a transaction of repo, or returns ErrNotTransactional
+// when repo does not implement Transactor
+func Transact(ctx context.Context, repo TodoRepositoryV2, fn func(tx TodoRepositoryV2) error) error {
+	t, ok := repo.(Transactor)
+	if !ok {
+		return errors.WithStack(ErrNotTransactional)
+	}
+	return t.Transact(ctx, fn)
+}
+
+// txStore is the storage of a backend, accessed while a transaction holds its write lock
+type txStore interface {
+	// load returns the todo todoID, or the error of notFound
+	load(ctx context.Context, todoID uuid.UUID) (models.Todo, error)
+	// list returns every todo
+	list(ctx context.Context) ([]models.Todo, error)
+	// commit applies the writes of a transaction, in order
+	commit(writes []txWrite) error
+}
+
+// txWrite is a write of a transaction, a nil todo deletes the todo
+type txWrite struct {
+	id   uuid.UUID
+	todo *models.Todo
+}
+
+// transact calls fn with a txTodoRepository over store, and commits its writes
+// unless fn fails. The caller holds the write lock of store
+func transact(ctx context.Context, store txStore, fn func(tx TodoRepositoryV2) error) error {
+	tx := &txTodoRepository{
+		store:  store,
+		staged: make(map[uuid.UUID]*models.Todo),
+	}
+	err := fn(tx)
+	tx.done = true
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	writes := make([]txWrite, 0, len(tx.order))
+	for _, id := range tx.order {
+		writes = append(writes, txWrite{id: id, todo: tx.staged[id]})
+	}
+	return store.commit(writes)
+}
+
+// txTodoRepository stages the writes of a transaction over a txStore,
+// and reads the todos as staged
+type txTodoRepository struct {
+	store txStore
+	// staged holds the todos written by the transaction, nil for deleted todos
+	staged map[uuid.UUID]*models.Todo
+	// order lists the staged todos in the order they were first written
+	order []uuid.UUID
+	done  bool
+}
+
+// get returns a copy of the todo todoID as staged
+func (t *txTodoRepository) get(ctx context.Context, todoID uuid.UUID) (models.Todo, error) {
+	if t.done {
+		return models.Todo{}, errors.WithStack(errTransactionDone)
+	}
+	if err := ctx.Err(); err != nil {
+		return models.Todo{}, errors.WithStack(err)
+	}
+	if todo, ok := t.staged[todoID]; ok {
+		if todo == nil {
+			return models.Todo{}, notFound(todoID)
+		}
+		return cloneTodo(*todo), nil
+	}
+	return t.store.load(ctx, todoID)
+}
+
+// stage stages todo, or the deletion of todoID when todo is nil
+func (t *txTodoRepository) stage(todoID uuid.UUID, todo *models.Todo) {
+	if _, ok := t.staged[todoID]; !ok {
+		t.order = append(t.order, todoID)
+	}
+	if todo != nil {
+		clone := cloneTodo(*todo)
+		todo = &clone
+	}
+	t.staged[todoID] = todo
+}
+
+// AddTodo stages new todo
+func (t *txTodoRepository) AddTodo(ctx context.Context, todo models.Todo) error {
+	_, err := t.get(ctx, todo.ID)
+	if err == nil {
+		return errors.New("duplicate todoID")
+	}
+	if !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+	t.stage(todo.ID, &todo)
+	return nil
+}
+
+// AddTask stages task added to existing todo
+func (t *txTodoRepository) AddTask(ctx context.Context, todoID uuid.UUID, task models.Task) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	for _, existing := range todo.Tasks {
+		if existing.ID == task.ID {
+			return errors.New("duplicate taskId")
+		}
+	}
+	todo.Tasks = append(todo.Tasks, task)
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// GetTodo returns the list of todo as staged, the todos added by the transaction last
+func (t *txTodoRepository) GetTodo(ctx context.Context) ([]models.Todo, error) {
+	if t.done {
+		return nil, errors.WithStack(errTransactionDone)
+	}
+	stored, err := t.store.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		todoList []models.Todo
+		listed   = make(map[uuid.UUID]bool, len(stored))
+	)
+	for _, todo := range stored {
+		listed[todo.ID] = true
+		if staged, ok := t.staged[todo.ID]; ok {
+			if staged == nil {
+				continue
+			}
+			todo = cloneTodo(*staged)
+		}
+		todoList = append(todoList, todo)
+	}
+	for _, id := range t.order {
+		if staged := t.staged[id]; staged != nil && !listed[id] {
+			todoList = append(todoList, cloneTodo(*staged))
+		}
+	}
+	return todoList, nil
+}
+
+// IterateTodo iterates over the list of todo as staged
+func (t *txTodoRepository) IterateTodo(ctx context.Context) (TodoIterator, error) {
+	todoList, err := t.GetTodo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewSliceTodoIterator(ctx, todoList), nil
+}
+
+// GetTodoByID returns todo by id as staged
+func (t *txTodoRepository) GetTodoByID(ctx context.Context, todoID uuid.UUID) (*models.Todo, error) {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// UpdateTodo stages the update of todo
+func (t *txTodoRepository) UpdateTodo(ctx context.Context, todoID uuid.UUID, completed bool, dueDate *time.Time) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todo.Completed = completed
+	todo.DueDate = dueDate
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// UpdateTask stages the update of a task of todo
+func (t *txTodoRepository) UpdateTask(ctx context.Context, todoID uuid.UUID, taskID uuid.UUID, completed bool, completedBy string) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	for i := range todo.Tasks {
+		if todo.Tasks[i].ID == taskID {
+			todo.Tasks[i].SetCompleted(completed, completedBy, time.Now().UTC())
+			break
+		}
+	}
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// DeleteTask stages the deletion of a task of todo
+func (t *txTodoRepository) DeleteTask(ctx context.Context, todoID, taskID uuid.UUID) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	for i := range todo.Tasks {
+		if todo.Tasks[i].ID == taskID {
+			todo.Tasks = append(todo.Tasks[:i:i], todo.Tasks[i+1:]...)
+			break
+		}
+	}
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// DeleteTodo stages the deletion of todo
+func (t *txTodoRepository) DeleteTodo(ctx context.Context, todoID uuid.UUID) error {
+	_, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	t.stage(todoID, nil)
+	return nil
+}
+
+// ShareTodo stages the sharing of todo with a collaborator
+func (t *txTodoRepository) ShareTodo(ctx context.Context, todoID uuid.UUID, collaborator models.Collaborator) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todo.Collaborators = share(todo.Collaborators, collaborator)
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// UnshareTodo stages the end of the sharing of todo with the collaborator userID
+func (t *txTodoRepository) UnshareTodo(ctx context.Context, todoID uuid.UUID, userID string) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todo.Collaborators = unshare(todo.Collaborators, userID)
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// TagTodo stages the tag of todo
+func (t *txTodoRepository) TagTodo(ctx context.Context, todoID uuid.UUID, tag string) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	err = addTag(&todo, tag)
+	if err != nil {
+		return err
+	}
+	t.stage(todoID, &todo)
+	return nil
+}
+
+// ArchiveTodo stages the archived state of todo
+func (t *txTodoRepository) ArchiveTodo(ctx context.Context, todoID uuid.UUID, archived bool) error {
+	todo, err := t.get(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todo.Archived = archived
+	t.stage(todoID, &todo)
+	return nil
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elumbantoruan/todo/models"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransact(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "todo")
+	defer os.RemoveAll(dir)
+
+	for name, repo := range map[string]TodoRepositoryV2{
+		"memory":      NewMemoryTodoRepository(),
+		"filestorage": NewFileStorageTodoRepository(dir),
+		"cached":      NewCachedTodoRepository(NewMemoryTodoRepository(), 10, 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			kept, deleted := newTodo(), newTodo()
+			assert.Nil(t, repo.AddTodo(ctx, kept))
+			assert.Nil(t, repo.AddTodo(ctx, deleted))
+			// caches the list, the transaction must invalidate it
+			repo.GetTodo(ctx)
+
+			// the writes of a failed transaction are discarded
+			added := newTodo()
+			err := Transact(ctx, repo, func(tx TodoRepositoryV2) error {
+				assert.Nil(t, tx.AddTodo(ctx, added))
+				assert.Nil(t, tx.DeleteTodo(ctx, deleted.ID))
+				return errors.New("rollback")
+			})
+			assert.EqualError(t, err, "rollback")
+			list, _ := repo.GetTodo(ctx)
+			assert.Equal(t, 2, len(list))
+			_, err = repo.GetTodoByID(ctx, added.ID)
+			assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+			// the transaction reads its own writes, and they are applied once it succeeds
+			err = Transact(ctx, repo, func(tx TodoRepositoryV2) error {
+				assert.Nil(t, tx.AddTodo(ctx, added))
+				assert.NotNil(t, tx.AddTodo(ctx, added))
+				assert.Nil(t, tx.AddTask(ctx, added.ID, models.Task{ID: uuid.New(), Name: "task"}))
+				assert.Nil(t, tx.UpdateTask(ctx, kept.ID, kept.Tasks[0].ID, true, "alice"))
+				assert.Nil(t, tx.DeleteTodo(ctx, deleted.ID))
+				_, err := tx.GetTodoByID(ctx, deleted.ID)
+				assert.True(t, os.IsNotExist(errors.Cause(err)))
+				list, err := tx.GetTodo(ctx)
+				assert.Nil(t, err)
+				assert.Equal(t, 2, len(list))
+				return nil
+			})
+			assert.Nil(t, err)
+
+			stored, err := repo.GetTodoByID(ctx, added.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, len(stored.Tasks))
+			stored, _ = repo.GetTodoByID(ctx, kept.ID)
+			assert.Equal(t, "alice", stored.Tasks[0].CompletedBy)
+			_, err = repo.GetTodoByID(ctx, deleted.ID)
+			assert.True(t, os.IsNotExist(errors.Cause(err)))
+			list, _ = repo.GetTodo(ctx)
+			assert.Equal(t, 2, len(list))
+		})
+	}
+}
+
+func TestTransact_NotTransactional(t *testing.T) {
+	repo := Chain(NewTodoRepositoryAdapter(MockTodoRepository{}), RequestID(), ACL())
+	err := Transact(context.Background(), repo, func(tx TodoRepositoryV2) error { return nil })
+	assert.Equal(t, ErrNotTransactional, errors.Cause(err))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+
+	"github.com/elumbantoruan/todo/config"
+	"github.com/elumbantoruan/todo/metrics"
+	"github.com/elumbantoruan/todo/repositories"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+)
+
+// newTodoRepository creates the storage backend selected by cfg and wraps it
+// with the cache, then with the logging, metrics and tracing decorators enabled by cfg.
+// With tenancy, each tenant gets its own backend and cache, created on demand.
+// The statistics of the caches are exported to the default prometheus registry
+func newTodoRepository(cfg config.Config) (repositories.TodoRepositoryV2, error) {
+	caches := metrics.NewCacheCollector()
+	err := prometheus.DefaultRegisterer.Register(caches)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo repositories.TodoRepositoryV2
+	if cfg.Tenancy.Enabled {
+		repo = repositories.NewTenantTodoRepository(cfg.Tenancy.DefaultTenant, func(tenantID string) (repositories.TodoRepositoryV2, error) {
+			storage := cfg.Storage
+			storage.File.DataDir = filepath.Join(storage.File.DataDir, tenantID)
+			return newStorage(storage, cfg, tenantID, caches)
+		})
+	} else {
+		repo, err = newStorage(cfg.Storage, cfg, "", caches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the outermost decorator observes the calls first, errors
+	// always carry the id of the request which caused them
+	middlewares := []repositories.Middleware{repositories.RequestID()}
+	if cfg.Repository.TracingEnabled(cfg.Tracing) {
+		middlewares = append(middlewares, repositories.Tracing(otel.Tracer("github.com/elumbantoruan/todo/repositories")))
+	}
+	if cfg.Repository.Metrics {
+		middlewares = append(middlewares, repositories.Metrics(prometheus.DefaultRegisterer))
+	}
+	if cfg.Repository.Logging {
+		middlewares = append(middlewares, repositories.Logging(slog.Default()))
+	}
+	// callers only reach the todos they own or collaborate on, as allowed by
+	// their role, innermost so the decorators observe it
+	if cfg.Auth.Enabled {
+		middlewares = append(middlewares, repositories.ACL())
+	}
+	return repositories.Chain(repo, middlewares...), nil
+}
+
+// newStorage creates the backend selected by storage, behind its cache
+// and the quotas of cfg. The cache is added to caches as the one of tenantID
+func newStorage(storage config.Storage, cfg config.Config, tenantID string, caches *metrics.CacheCollector) (repositories.TodoRepositoryV2, error) {
+	var repo repositories.TodoRepositoryV2
+	switch storage.Backend {
+	case config.BackendMemory:
+		repo = repositories.NewMemoryTodoRepository()
+	default:
+		fr, err := newFileStorage(storage.File)
+		if err != nil {
+			return nil, err
+		}
+		repo = fr
+	}
+
+	if storage.Cache.Entries > 0 {
+		cache := repositories.NewCachedTodoRepository(repo, storage.Cache.Entries, storage.Cache.TTL)
+		caches.Add(tenantID, cache)
+		repo = cache
+	}
+	if cfg.Tenancy.MaxTodos > 0 || cfg.Tenancy.MaxTasks > 0 || cfg.Limits.MaxTasksPerTodo > 0 {
+		repo = repositories.Quota(cfg.Tenancy.MaxTodos, cfg.Tenancy.MaxTasks, cfg.Limits.MaxTasksPerTodo)(repo)
+	}
+	return repo, nil
+}
@@ -0,0 +1,31 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Header is the default http header naming the tenant of a request
+const Header = "X-Tenant-ID"
+
+// validID matches the tenant ids, which name a directory or a subdomain
+var validID = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Valid reports whether id is a valid tenant id: lowercase letters,
+// digits and inner dashes, at most 63 characters
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the tenant id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant id carried by ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log/slog"
+
+	"github.com/elumbantoruan/todo/certs"
+	"github.com/elumbantoruan/todo/config"
+	"github.com/pkg/errors"
+)
+
+// newTLSConfig returns the TLS configuration of the server, serving the certificate
+// of cfg and reloading it when it changes, and verifying client certificates
+// when client authentication is enabled
+func newTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	if cfg.SelfSigned {
+		generated, err := certs.GenerateSelfSigned(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			slog.Warn("generated a self-signed certificate, for development only", "certFile", cfg.CertFile)
+		}
+	}
+	reloader, err := certs.NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch cfg.ClientAuth {
+	case config.ClientAuthRequest:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return tlsConfig, nil
+	}
+	pem, err := ioutil.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("%s: no PEM certificate found", cfg.ClientCAFile)
+	}
+	return tlsConfig, nil
+}
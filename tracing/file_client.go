@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// fileClient is an otlptrace.Client which writes every batch of spans
+// to w as one line of OTLP JSON, so traces can be collected offline
+type fileClient struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newFileClient(w io.Writer) *fileClient {
+	return &fileClient{
+		w: w,
+	}
+}
+
+// Start implements otlptrace.Client
+func (c *fileClient) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop implements otlptrace.Client, it closes the file
+func (c *fileClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return closeWriter(c.w)
+}
+
+// UploadTraces implements otlptrace.Client
+func (c *fileClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	request := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: protoSpans,
+	}
+	line, err := marshalOTLP(request)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = c.w.Write(append(line, '\n'))
+	return errors.WithStack(err)
+}
+
+// marshalOTLP encodes request in the OTLP JSON format.
+// protojson encodes bytes in base64, while OTLP JSON requires trace and span ids in hex
+func marshalOTLP(request *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	bts, err := protojson.Marshal(request)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var doc interface{}
+	err = json.Unmarshal(bts, &doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	hexIDs(doc)
+	bts, err = json.Marshal(doc)
+	return bts, errors.WithStack(err)
+}
+
+// hexIDs rewrites every base64 trace and span id found in doc in hex
+func hexIDs(doc interface{}) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && (key == "traceId" || key == "spanId" || key == "parentSpanId") {
+				if id, err := base64.StdEncoding.DecodeString(s); err == nil {
+					v[key] = hex.EncodeToString(id)
+				}
+				continue
+			}
+			hexIDs(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			hexIDs(value)
+		}
+	}
+}
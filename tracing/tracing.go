@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters supported by Setup
+const (
+	// ExporterNone disables tracing, spans are still propagated
+	ExporterNone = "none"
+	// ExporterStdout writes spans as JSON to stdout
+	ExporterStdout = "stdout"
+	// ExporterFile appends spans to a file in the OTLP JSON format, one batch per line
+	ExporterFile = "file"
+)
+
+// Config selects the span exporter
+type Config struct {
+	ServiceName string
+	Exporter    string
+	File        string
+}
+
+// Setup installs the global tracer provider with the exporter selected by cfg,
+// and the W3C traceparent and baggage propagators.
+// The returned function flushes pending spans and releases the exporter
+func Setup(cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, errors.New("a file is required by the file exporter")
+		}
+		var f *os.File
+		f, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		exporter, err = otlptrace.New(context.Background(), newFileClient(f))
+	default:
+		return nil, errors.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// schemaless, so it merges with the default resource whatever semconv version it uses
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// closeWriter closes w when it is an io.Closer
+func closeWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
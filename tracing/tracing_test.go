@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tracing")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "traces.jsonl")
+
+	shutdown, err := Setup(Config{
+		ServiceName: "todo",
+		Exporter:    ExporterFile,
+		File:        file,
+	})
+	assert.Nil(t, err)
+
+	// the span continues the trace of the incoming traceparent
+	carrier := propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	_, span := otel.Tracer("test").Start(ctx, "span")
+	span.End()
+
+	err = shutdown(context.Background())
+	assert.Nil(t, err)
+
+	bts, _ := ioutil.ReadFile(file)
+	assert.True(t, strings.Contains(string(bts), `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`))
+	assert.True(t, strings.Contains(string(bts), `"name":"span"`))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// version and commit are set at build time with
+// go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// buildCommit returns the commit set at build time,
+// or the vcs revision stamped by the go tool
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// goVersion returns the version of Go the server is built with
+func goVersion() string {
+	return runtime.Version()
+}